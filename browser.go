@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandancd/httpstat/browser"
+)
+
+// runBrowserProbe loads url in a headless browser and prints its timing
+// along with the resources the page requested
+func runBrowserProbe(url string, timeout time.Duration, output string) error {
+	result, err := browser.Run(context.Background(), browser.Options{
+		URL:     url,
+		Timeout: timeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	if output == "har" {
+		printResults("json", result.Page, result.Page.HAR())
+		return nil
+	}
+	printResults(output, result, result.JSON())
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package browser measures page loads in headless Chrome using the
+// Navigation Timing API and reports them in the same shape as raw HTTP
+// probes, so both kinds of results can be compared side by side. Every
+// subresource request is recorded with its own timing breakdown.
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+
+	"github.com/vandancd/httpstat/probe"
+)
+
+// phaseDocument is the trace phase of document lifecycle events
+const phaseDocument = "document"
+
+// Options configures a browser probe
+type Options struct {
+	URL     string
+	Timeout time.Duration // Overall page load timeout, zero means no timeout
+}
+
+// navigationTiming mirrors the PerformanceNavigationTiming entry of the
+// page. Every timestamp is in milliseconds relative to TimeOrigin.
+type navigationTiming struct {
+	Name                     string  `json:"name"`
+	NextHopProtocol          string  `json:"nextHopProtocol"`
+	TimeOrigin               float64 `json:"timeOrigin"`
+	RedirectCount            int     `json:"redirectCount"`
+	RedirectStart            float64 `json:"redirectStart"`
+	RedirectEnd              float64 `json:"redirectEnd"`
+	FetchStart               float64 `json:"fetchStart"`
+	DomainLookupStart        float64 `json:"domainLookupStart"`
+	DomainLookupEnd          float64 `json:"domainLookupEnd"`
+	ConnectStart             float64 `json:"connectStart"`
+	SecureConnectionStart    float64 `json:"secureConnectionStart"`
+	ConnectEnd               float64 `json:"connectEnd"`
+	RequestStart             float64 `json:"requestStart"`
+	ResponseStart            float64 `json:"responseStart"`
+	ResponseEnd              float64 `json:"responseEnd"`
+	DOMContentLoadedEventEnd float64 `json:"domContentLoadedEventEnd"`
+	LoadEventEnd             float64 `json:"loadEventEnd"`
+	EncodedBodySize          int64   `json:"encodedBodySize"`
+}
+
+// navigationTimingScript resolves with the navigation entry once the load
+// event has finished, since loadEventEnd stays zero until then
+const navigationTimingScript = `new Promise(resolve => {
+	const check = () => {
+		const entry = performance.getEntriesByType("navigation")[0];
+		if (entry && entry.loadEventEnd > 0) {
+			resolve(Object.assign(entry.toJSON(), {timeOrigin: performance.timeOrigin}));
+		} else {
+			setTimeout(check, 10);
+		}
+	};
+	check();
+})`
+
+// millis converts a Navigation Timing interval into a duration
+func millis(from, to float64) time.Duration {
+	if from <= 0 || to <= from {
+		return 0
+	}
+	return time.Duration((to - from) * float64(time.Millisecond))
+}
+
+// Result holds the document's timing in the shape of a probe result along
+// with every resource the page requested
+type Result struct {
+	Page      *probe.Result
+	Resources []Resource
+}
+
+// Run loads the page in a fresh headless browser with the cache disabled,
+// converts its Navigation Timing into a probe result and records the
+// network requests made until the load event
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("no URL given")
+	}
+	target := probe.NormalizeURL(opts.URL)
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, chromedp.DefaultExecAllocatorOptions[:]...)
+	defer cancelAlloc()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+
+	recorder := newResourceRecorder()
+	chromedp.ListenTarget(browserCtx, recorder.handleEvent)
+
+	// Start the browser and disable the cache before navigating, so the
+	// timing reflects a cold load of the document
+	if err := chromedp.Run(browserCtx, network.Enable(), network.SetCacheDisabled(true)); err != nil {
+		return nil, fmt.Errorf("error starting browser: %w", err)
+	}
+
+	resp, err := chromedp.RunResponse(browserCtx, chromedp.Navigate(target))
+	if err != nil {
+		return nil, fmt.Errorf("error loading page: %w", err)
+	}
+
+	var nav navigationTiming
+	var raw []byte
+	err = chromedp.Run(browserCtx, chromedp.Evaluate(navigationTimingScript, &raw,
+		func(p *runtime.EvaluateParams) *runtime.EvaluateParams { return p.WithAwaitPromise(true) }))
+	if err != nil {
+		return nil, fmt.Errorf("error reading navigation timing: %w", err)
+	}
+	if err := json.Unmarshal(raw, &nav); err != nil {
+		return nil, fmt.Errorf("error decoding navigation timing: %w", err)
+	}
+
+	return &Result{
+		Page:      newResult(resp, nav),
+		Resources: recorder.snapshot(),
+	}, nil
+}
+
+// ResultJSON represents a browser result in JSON format. The page fields
+// are inlined so the document looks like a regular probe response.
+type ResultJSON struct {
+	probe.ResponseJSON
+	Resources []ResourceJSON `json:"resources"`
+}
+
+// JSON converts the result into its JSON representation
+func (r *Result) JSON() ResultJSON {
+	return ResultJSON{
+		ResponseJSON: r.Page.JSON(),
+		Resources:    resourcesJSON(r.Page.StartTime, r.Resources),
+	}
+}
+
+// WriteText renders the page timing followed by a waterfall of its
+// resources
+func (r *Result) WriteText(w io.Writer, color bool) error {
+	if err := r.Page.WriteText(w, color); err != nil {
+		return err
+	}
+	return writeResources(w, color, r.Resources)
+}
+
+// newResult converts the document response and its navigation timing
+func newResult(resp *network.Response, nav navigationTiming) *probe.Result {
+	origin := time.UnixMicro(int64(math.Round(nav.TimeOrigin * 1000)))
+
+	connectEnd := nav.ConnectEnd
+	var tlsHandshake time.Duration
+	if nav.SecureConnectionStart > 0 {
+		tlsHandshake = millis(nav.SecureConnectionStart, nav.ConnectEnd)
+		connectEnd = nav.SecureConnectionStart
+	}
+
+	timing := probe.Timing{
+		DNSLookup:        millis(nav.DomainLookupStart, nav.DomainLookupEnd),
+		TCPConnection:    millis(nav.ConnectStart, connectEnd),
+		TLSHandshake:     tlsHandshake,
+		ServerProcessing: millis(nav.FetchStart, nav.ResponseStart),
+		ContentTransfer:  millis(nav.ResponseStart, nav.ResponseEnd),
+		Total:            millis(nav.FetchStart, nav.ResponseEnd),
+		ReusedConnection: resp.ConnectionReused,
+	}
+
+	statusCode := int(resp.Status)
+
+	result := &probe.Result{
+		URL:            resp.URL,
+		HTTPProtocol:   httpProtocol(resp.Protocol),
+		StatusCode:     statusCode,
+		Status:         statusLine(statusCode, resp.StatusText),
+		ResponseHeader: responseHeader(resp.Headers),
+		BodySize:       nav.EncodedBodySize,
+		StartTime:      origin.Add(millis(0, nav.FetchStart)),
+		Timing:         timing,
+		Request:        probe.RequestInfo{Method: http.MethodGet, BodySize: 0},
+		Browser: &probe.BrowserTiming{
+			DOMContentLoaded: millis(0, nav.DOMContentLoadedEventEnd),
+			Load:             millis(0, nav.LoadEventEnd),
+			RedirectCount:    nav.RedirectCount,
+			Redirect:         millis(nav.RedirectStart, nav.RedirectEnd),
+		},
+	}
+	result.TraceEvents = navigationEvents(origin, nav, resp)
+	return result
+}
+
+// navigationEvents turns the navigation milestones into trace events
+func navigationEvents(origin time.Time, nav navigationTiming, resp *network.Response) []probe.TraceEvent {
+	host := nav.Name
+	if u, err := url.Parse(nav.Name); err == nil {
+		host = u.Host
+	}
+
+	var events []probe.TraceEvent
+	add := func(at float64, phase, event string, attrs map[string]interface{}, format string, args ...interface{}) {
+		if at <= 0 {
+			return
+		}
+		offset := millis(0, at)
+		events = append(events, probe.TraceEvent{
+			Phase:   phase,
+			Event:   event,
+			Offset:  offset,
+			Time:    origin.Add(offset),
+			Message: fmt.Sprintf(format, args...),
+			Attrs:   attrs,
+		})
+	}
+
+	add(nav.RedirectStart, probe.PhaseConnection, "redirect_start", map[string]interface{}{"count": nav.RedirectCount},
+		"Following %d redirects", nav.RedirectCount)
+	add(nav.FetchStart, probe.PhaseConnection, "fetch_start", map[string]interface{}{"url": nav.Name},
+		"Fetching %s", nav.Name)
+	if !resp.ConnectionReused {
+		add(nav.DomainLookupStart, probe.PhaseDNS, "dns_start", map[string]interface{}{"host": host},
+			"DNS lookup starting for %s", host)
+		add(nav.DomainLookupEnd, probe.PhaseDNS, "dns_done", nil, "DNS lookup completed")
+		add(nav.ConnectStart, probe.PhaseConnect, "connect_start", map[string]interface{}{"addr": resp.RemoteIPAddress},
+			"Connection attempt to %s", resp.RemoteIPAddress)
+		add(nav.SecureConnectionStart, probe.PhaseTLS, "tls_start", nil, "TLS handshake starting")
+		add(nav.ConnectEnd, probe.PhaseConnect, "connect_done", map[string]interface{}{"addr": resp.RemoteIPAddress},
+			"Connected to %s", resp.RemoteIPAddress)
+	}
+	add(nav.RequestStart, probe.PhaseRequest, "wrote_request", map[string]interface{}{"method": http.MethodGet},
+		"%s request written", http.MethodGet)
+	add(nav.ResponseStart, probe.PhaseResponse, "first_byte", nil, "First response byte received (TTFB)")
+	add(nav.ResponseEnd, probe.PhaseResponse, "body_done", nil, "Response body fully read (TTLB)")
+	add(nav.DOMContentLoadedEventEnd, phaseDocument, "dom_content_loaded", nil, "DOMContentLoaded event finished")
+	add(nav.LoadEventEnd, phaseDocument, "load", nil, "Load event finished")
+	return events
+}
+
+// statusLine formats a status such as "200 OK", falling back to the
+// standard text when the browser reports none, as it does for HTTP/2
+func statusLine(code int, text string) string {
+	if text == "" {
+		text = http.StatusText(code)
+	}
+	return fmt.Sprintf("%d %s", code, text)
+}
+
+// httpProtocol converts an ALPN protocol name into a response protocol
+func httpProtocol(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "h2":
+		return "HTTP/2.0"
+	case "h3":
+		return "HTTP/3.0"
+	case "http/1.1":
+		return "HTTP/1.1"
+	case "http/1.0":
+		return "HTTP/1.0"
+	}
+	return protocol
+}
+
+// responseHeader converts DevTools headers into an http.Header
+func responseHeader(headers network.Headers) http.Header {
+	header := make(http.Header, len(headers))
+	for name, value := range headers {
+		// DevTools joins repeated headers with newlines
+		for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+			header.Add(name, v)
+		}
+	}
+	return header
+}
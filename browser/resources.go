@@ -0,0 +1,322 @@
+package browser
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+
+	"github.com/vandancd/httpstat/probe"
+)
+
+// Cache statuses of a resource
+const (
+	CacheNone          = "none"
+	CacheDisk          = "disk"
+	CacheMemory        = "memory"
+	CachePrefetch      = "prefetch"
+	CacheServiceWorker = "service-worker"
+)
+
+// Resource is a single network request made while loading the page. Its
+// Timing follows the same conventions as a probe hop: ServerProcessing runs
+// from the start of the request to the response headers, so it includes any
+// connection setup.
+type Resource struct {
+	URL          string
+	Type         string // Resource type reported by the browser, such as Script or Image
+	Method       string
+	Initiator    string // What caused the request, such as parser or script
+	InitiatorURL string
+	StatusCode   int
+	Status       string
+	Protocol     string
+	MimeType     string
+	RemoteAddr   string
+	Size         int64 // Encoded bytes received, including headers
+	Cache        string
+	StartTime    time.Time
+	Timing       probe.Timing
+	Error        string // Set when the request failed or did not finish
+}
+
+// resourceRecorder collects resources from DevTools network events
+type resourceRecorder struct {
+	mu        sync.Mutex
+	resources []*Resource
+	pending   map[network.RequestID]*pendingResource
+	wallClock time.Duration // Offset from monotonic to wall clock time
+}
+
+// pendingResource is a resource that has not finished loading yet
+type pendingResource struct {
+	resource  *Resource
+	sent      time.Time     // Monotonic time the request was sent
+	wallClock time.Duration // Offset from monotonic to wall clock time
+	timing    *network.ResourceTiming
+}
+
+func newResourceRecorder() *resourceRecorder {
+	return &resourceRecorder{pending: make(map[network.RequestID]*pendingResource)}
+}
+
+// monotonic converts a DevTools timestamp into a time.Time
+func monotonic(t *cdp.MonotonicTime) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time()
+}
+
+// handleEvent records a DevTools network event. It is called synchronously
+// by chromedp, so it must not block.
+func (r *resourceRecorder) handleEvent(ev interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		sent := monotonic(ev.Timestamp)
+		if len(r.resources) == 0 && ev.WallTime != nil {
+			r.wallClock = ev.WallTime.Time().Sub(sent)
+		}
+		// Redirects reuse the request ID, so the previous hop ends here
+		if ev.RedirectResponse != nil {
+			if p, ok := r.pending[ev.RequestID]; ok {
+				p.setResponse(ev.RedirectResponse)
+				p.finish(sent, int64(ev.RedirectResponse.EncodedDataLength), "")
+				delete(r.pending, ev.RequestID)
+			}
+		}
+
+		resource := &Resource{
+			URL:       ev.Request.URL,
+			Type:      string(ev.Type),
+			Method:    ev.Request.Method,
+			Cache:     CacheNone,
+			StartTime: sent.Add(r.wallClock),
+			Error:     "not finished before the load event",
+		}
+		if ev.Initiator != nil {
+			resource.Initiator = string(ev.Initiator.Type)
+			resource.InitiatorURL = ev.Initiator.URL
+		}
+		if ev.RedirectResponse != nil {
+			resource.Initiator = "redirect"
+			resource.InitiatorURL = ev.RedirectResponse.URL
+		}
+		r.resources = append(r.resources, resource)
+		r.pending[ev.RequestID] = &pendingResource{resource: resource, sent: sent, wallClock: r.wallClock}
+
+	case *network.EventResponseReceived:
+		if p, ok := r.pending[ev.RequestID]; ok {
+			if ev.Type != "" {
+				p.resource.Type = string(ev.Type)
+			}
+			p.setResponse(ev.Response)
+		}
+
+	case *network.EventRequestServedFromCache:
+		if p, ok := r.pending[ev.RequestID]; ok {
+			p.resource.Cache = CacheMemory
+		}
+
+	case *network.EventLoadingFinished:
+		if p, ok := r.pending[ev.RequestID]; ok {
+			p.finish(monotonic(ev.Timestamp), int64(ev.EncodedDataLength), "")
+			delete(r.pending, ev.RequestID)
+		}
+
+	case *network.EventLoadingFailed:
+		if p, ok := r.pending[ev.RequestID]; ok {
+			reason := ev.ErrorText
+			if ev.Canceled {
+				reason = "canceled"
+			} else if ev.BlockedReason != "" {
+				reason = fmt.Sprintf("%s (blocked: %s)", reason, ev.BlockedReason)
+			}
+			p.finish(monotonic(ev.Timestamp), 0, reason)
+			delete(r.pending, ev.RequestID)
+		}
+	}
+}
+
+// setResponse records the response of a pending resource
+func (p *pendingResource) setResponse(resp *network.Response) {
+	resource := p.resource
+	resource.StatusCode = int(resp.Status)
+	resource.Status = statusLine(resource.StatusCode, resp.StatusText)
+	resource.Protocol = httpProtocol(resp.Protocol)
+	resource.MimeType = resp.MimeType
+	resource.RemoteAddr = resp.RemoteIPAddress
+	if resp.RemoteIPAddress != "" && resp.RemotePort > 0 {
+		resource.RemoteAddr = net.JoinHostPort(resp.RemoteIPAddress, strconv.FormatInt(resp.RemotePort, 10))
+	}
+	resource.Timing.ReusedConnection = resp.ConnectionReused
+
+	switch {
+	case resp.FromServiceWorker:
+		resource.Cache = CacheServiceWorker
+	case resp.FromPrefetchCache:
+		resource.Cache = CachePrefetch
+	case resp.FromDiskCache:
+		resource.Cache = CacheDisk
+	}
+	p.timing = resp.Timing
+}
+
+// finish completes the resource's timing at the given monotonic time.
+// ResourceTiming values are milliseconds relative to RequestTime, with -1
+// meaning the phase did not happen.
+func (p *pendingResource) finish(end time.Time, size int64, reason string) {
+	resource := p.resource
+	resource.Size = size
+	resource.Error = reason
+
+	t := p.timing
+	if t == nil {
+		// Cached and failed requests carry no detailed timing
+		resource.Timing.Total = end.Sub(p.sent)
+		return
+	}
+
+	requestTime := cdp.MonotonicTimeEpoch.Add(time.Duration(t.RequestTime * float64(time.Second)))
+	connectEnd := t.ConnectEnd
+	if t.SslStart >= 0 {
+		connectEnd = t.SslStart
+		resource.Timing.TLSHandshake = span(t.SslStart, t.SslEnd)
+	}
+	resource.Timing.DNSLookup = span(t.DNSStart, t.DNSEnd)
+	resource.Timing.TCPConnection = span(t.ConnectStart, connectEnd)
+	resource.Timing.RequestWrite = span(t.SendStart, t.SendEnd)
+	resource.Timing.ServerProcessing = span(0, t.ReceiveHeadersEnd)
+
+	headersEnd := requestTime.Add(resource.Timing.ServerProcessing)
+	if end.After(headersEnd) {
+		resource.Timing.ContentTransfer = end.Sub(headersEnd)
+	}
+	if end.After(requestTime) {
+		resource.Timing.Total = end.Sub(requestTime)
+	}
+	resource.StartTime = requestTime.Add(p.wallClock)
+}
+
+// span converts a ResourceTiming interval into a duration
+func span(from, to float64) time.Duration {
+	if from < 0 || to < from {
+		return 0
+	}
+	return time.Duration((to - from) * float64(time.Millisecond))
+}
+
+// snapshot returns the recorded resources ordered by start time. Resources
+// that are still loading keep their unfinished error.
+func (r *resourceRecorder) snapshot() []Resource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resources := make([]Resource, 0, len(r.resources))
+	for _, resource := range r.resources {
+		resources = append(resources, *resource)
+	}
+	sort.SliceStable(resources, func(i, j int) bool { return resources[i].StartTime.Before(resources[j].StartTime) })
+	return resources
+}
+
+// ResourceJSON represents a resource in JSON format
+type ResourceJSON struct {
+	URL          string           `json:"url"`
+	Type         string           `json:"type"`
+	Method       string           `json:"method"`
+	Initiator    string           `json:"initiator,omitempty"`
+	InitiatorURL string           `json:"initiator_url,omitempty"`
+	StatusCode   int              `json:"status_code,omitempty"`
+	Protocol     string           `json:"http_protocol,omitempty"`
+	MimeType     string           `json:"mime_type,omitempty"`
+	RemoteAddr   string           `json:"remote_addr,omitempty"`
+	Size         int64            `json:"size"`
+	Cache        string           `json:"cache"`
+	StartOffset  string           `json:"start_offset"`
+	Connection   string           `json:"connection"`
+	Timing       probe.TimingJSON `json:"timing"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// resourcesJSON converts resources into their JSON representation, with
+// start offsets relative to the page's start time
+func resourcesJSON(start time.Time, resources []Resource) []ResourceJSON {
+	result := make([]ResourceJSON, 0, len(resources))
+	for _, resource := range resources {
+		result = append(result, ResourceJSON{
+			URL:          resource.URL,
+			Type:         resource.Type,
+			Method:       resource.Method,
+			Initiator:    resource.Initiator,
+			InitiatorURL: resource.InitiatorURL,
+			StatusCode:   resource.StatusCode,
+			Protocol:     resource.Protocol,
+			MimeType:     resource.MimeType,
+			RemoteAddr:   resource.RemoteAddr,
+			Size:         resource.Size,
+			Cache:        resource.Cache,
+			StartOffset:  probe.FormatDuration(resource.StartTime.Sub(start)),
+			Connection:   connectionInfo(resource),
+			Timing:       resource.Timing.JSON(),
+			Error:        resource.Error,
+		})
+	}
+	return result
+}
+
+// connectionInfo describes how a resource reached the network
+func connectionInfo(resource Resource) string {
+	if resource.Cache != CacheNone {
+		return "cached"
+	}
+	if resource.Timing.ReusedConnection {
+		return "reused"
+	}
+	return "new"
+}
+
+// writeResources draws the resources as a waterfall on the page's time axis
+func writeResources(w io.Writer, color bool, resources []Resource) error {
+	rows := make([]probe.WaterfallRow, 0, len(resources))
+	for _, resource := range resources {
+		label := fmt.Sprintf("%d", resource.StatusCode)
+		note := fmt.Sprintf("%s %s", resource.Type, formatSize(resource.Size))
+		if resource.Cache != CacheNone {
+			note += " (" + resource.Cache + " cache)"
+		}
+		if resource.Error != "" {
+			label = "ERR"
+			note += " " + resource.Error
+		}
+		rows = append(rows, probe.WaterfallRow{
+			Label:  label,
+			URL:    resource.URL,
+			Start:  resource.StartTime,
+			Total:  resource.Timing.Total,
+			Timing: resource.Timing,
+			Note:   note,
+		})
+	}
+	return probe.WriteWaterfall(w, color, fmt.Sprintf("Resources: %d", len(resources)), rows)
+}
+
+// formatSize formats a byte count for the resource table
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/vandancd/httpstat/probe"
+)
+
+// headerFlag collects repeatable curl-style "Name: value" headers
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	return ""
+}
+
+func (f *headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header %q, expected 'Name: value'", value)
+	}
+	f.header.Add(name, strings.TrimSpace(val))
+	return nil
+}
+
+// pinFlag collects repeated -pin values
+type pinFlag struct {
+	pins []string
+}
+
+func (f *pinFlag) String() string {
+	return strings.Join(f.pins, ", ")
+}
+
+func (f *pinFlag) Set(value string) error {
+	pin, err := probe.ParsePin(value)
+	if err != nil {
+		return err
+	}
+	f.pins = append(f.pins, pin)
+	return nil
+}
+
+// resolveFlag collects repeated -resolve rules
+type resolveFlag struct {
+	rules []probe.ResolveRule
+}
+
+func (f *resolveFlag) String() string {
+	return ""
+}
+
+func (f *resolveFlag) Set(value string) error {
+	rule, err := probe.ParseResolve(value)
+	if err != nil {
+		return err
+	}
+	f.rules = append(f.rules, rule)
+	return nil
+}
+
+// connectToFlag collects repeated -connect-to rules
+type connectToFlag struct {
+	rules []probe.ConnectToRule
+}
+
+func (f *connectToFlag) String() string {
+	return ""
+}
+
+func (f *connectToFlag) Set(value string) error {
+	rule, err := probe.ParseConnectTo(value)
+	if err != nil {
+		return err
+	}
+	f.rules = append(f.rules, rule)
+	return nil
+}
+
+// dataFlag collects curl-style request body parts in command line order.
+// All data flags share one parts slice so that mixing -d, --data-binary and
+// --data-urlencode keeps the order they were given in.
+type dataFlag struct {
+	parts  *[]string
+	encode func(string) (string, error)
+}
+
+func (f dataFlag) String() string {
+	return ""
+}
+
+func (f dataFlag) Set(value string) error {
+	part, err := f.encode(value)
+	if err != nil {
+		return err
+	}
+	*f.parts = append(*f.parts, part)
+	return nil
+}
+
+// applyData sends the data parts as a form post, the way curl does: joined
+// with &, with POST unless -X names another method, and form encoded
+// unless a Content-Type header was given
+func applyData(opts *probe.Options, parts []string) {
+	if len(parts) == 0 {
+		return
+	}
+	opts.Body = []byte(strings.Join(parts, "&"))
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.Header == nil {
+		opts.Header = make(http.Header)
+	}
+	if opts.Header.Get("Content-Type") == "" {
+		opts.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+}
+
+// readDataFile reads the file named by an @file data argument
+func readDataFile(name string) (string, error) {
+	if name == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("error reading data from stdin: %v", err)
+		}
+		return string(data), nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("error reading data file: %v", err)
+	}
+	return string(data), nil
+}
+
+// encodeData handles -d: @file contents are sent without carriage returns
+// and newlines, like curl does
+func encodeData(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	data, err := readDataFile(value[1:])
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(data), nil
+}
+
+// encodeDataBinary handles --data-binary: @file contents are sent as is
+func encodeDataBinary(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	return readDataFile(value[1:])
+}
+
+// encodeDataURLEncode handles --data-urlencode, which accepts "content",
+// "=content", "name=content", "@file" and "name@file"
+func encodeDataURLEncode(value string) (string, error) {
+	if i := strings.IndexAny(value, "=@"); i >= 0 {
+		name, content := value[:i], value[i+1:]
+		if value[i] == '@' {
+			data, err := readDataFile(content)
+			if err != nil {
+				return "", err
+			}
+			content = data
+		}
+		if name == "" {
+			return url.QueryEscape(content), nil
+		}
+		return name + "=" + url.QueryEscape(content), nil
+	}
+	return url.QueryEscape(value), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vandancd/httpstat/probe"
+)
+
+// parseData parses data flags registered the way main does and returns the
+// body parts in order
+func parseData(t *testing.T, args ...string) ([]string, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("httpstat", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var parts []string
+	fs.Var(dataFlag{&parts, encodeData}, "d", "")
+	fs.Var(dataFlag{&parts, encodeDataBinary}, "data-binary", "")
+	fs.Var(dataFlag{&parts, encodeDataURLEncode}, "data-urlencode", "")
+	err := fs.Parse(args)
+	return parts, err
+}
+
+func TestDataFlags(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "body.txt")
+	if err := os.WriteFile(file, []byte("a=1\r\nb=2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "text.txt")
+	if err := os.WriteFile(text, []byte("hello world&more\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "data as given", args: []string{"-d", "a=1 b"}, want: "a=1 b"},
+		{name: "data file without newlines", args: []string{"-d", "@" + file}, want: "a=1b=2"},
+		{name: "binary as given", args: []string{"--data-binary", "a=1\n"}, want: "a=1\n"},
+		{name: "binary file as is", args: []string{"--data-binary", "@" + file}, want: "a=1\r\nb=2\n"},
+		{name: "urlencode content", args: []string{"--data-urlencode", "hello world&more"}, want: "hello+world%26more"},
+		{name: "urlencode =content", args: []string{"--data-urlencode", "=a=b c"}, want: "a%3Db+c"},
+		{name: "urlencode name=content", args: []string{"--data-urlencode", "msg=a=b c"}, want: "msg=a%3Db+c"},
+		{name: "urlencode @file", args: []string{"--data-urlencode", "@" + text}, want: "hello+world%26more%0A"},
+		{name: "urlencode name@file", args: []string{"--data-urlencode", "msg@" + text}, want: "msg=hello+world%26more%0A"},
+		{
+			name: "repeated values joined in order",
+			args: []string{"-d", "a=1", "--data-urlencode", "b=x y", "--data-binary", "c=3", "-d", "d=4"},
+			want: "a=1&b=x+y&c=3&d=4",
+		},
+		{name: "missing data file", args: []string{"-d", "@" + filepath.Join(dir, "missing")}, wantErr: "error reading data file"},
+		{name: "missing urlencode file", args: []string{"--data-urlencode", "msg@" + filepath.Join(dir, "missing")}, wantErr: "error reading data file"},
+	}
+
+	for _, tt := range tests {
+		parts, err := parseData(t, tt.args...)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		var opts probe.Options
+		applyData(&opts, parts)
+		if got := string(opts.Body); got != tt.want {
+			t.Errorf("%s: body = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyData(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		header          http.Header
+		parts           []string
+		wantMethod      string
+		wantContentType string
+		wantBody        bool
+	}{
+		{name: "no data", wantMethod: "", wantContentType: ""},
+		{name: "implicit POST", parts: []string{"a=1"}, wantMethod: http.MethodPost,
+			wantContentType: "application/x-www-form-urlencoded", wantBody: true},
+		{name: "explicit method kept", method: http.MethodPut, parts: []string{"a=1"}, wantMethod: http.MethodPut,
+			wantContentType: "application/x-www-form-urlencoded", wantBody: true},
+		{name: "explicit content type kept", header: http.Header{"Content-Type": {"application/json"}}, parts: []string{`{"a":1}`},
+			wantMethod: http.MethodPost, wantContentType: "application/json", wantBody: true},
+	}
+
+	for _, tt := range tests {
+		opts := probe.Options{Method: tt.method, Header: tt.header}
+		applyData(&opts, tt.parts)
+		if opts.Method != tt.wantMethod {
+			t.Errorf("%s: method = %q, want %q", tt.name, opts.Method, tt.wantMethod)
+		}
+		if got := opts.Header.Get("Content-Type"); got != tt.wantContentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got, tt.wantContentType)
+		}
+		if (opts.Body != nil) != tt.wantBody {
+			t.Errorf("%s: body = %q, want one: %v", tt.name, opts.Body, tt.wantBody)
+		}
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	headers := &headerFlag{header: make(http.Header)}
+	for _, value := range []string{"Host: example.com", "X-Test:  a ", "X-Test: b", "Empty:"} {
+		if err := headers.Set(value); err != nil {
+			t.Errorf("Set(%q) error = %v", value, err)
+		}
+	}
+	if got := headers.header.Get("Host"); got != "example.com" {
+		t.Errorf("Host = %q, want example.com", got)
+	}
+	if got := headers.header.Values("X-Test"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("X-Test = %q, want a and b", got)
+	}
+	if got, ok := headers.header["Empty"]; !ok || got[0] != "" {
+		t.Errorf("Empty = %q, want an empty value", got)
+	}
+	for _, value := range []string{"no colon", ": value", " : value"} {
+		if err := headers.Set(value); err == nil {
+			t.Errorf("Set(%q) accepted an invalid header", value)
+		}
+	}
+}
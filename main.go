@@ -2,53 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"net"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
-)
-
-// Global variable to track if we're using a custom resolver
-var resolver *net.Resolver
-
-// customDialer extends net.Dialer with IPv6 preference
-type customDialer struct {
-	*net.Dialer
-	preferIPv6 bool
-}
-
-func (d *customDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	if d.preferIPv6 {
-		host, port, err := net.SplitHostPort(address)
-		if err != nil {
-			return nil, err
-		}
-
-		// Resolve the IP addresses
-		ips, err := net.DefaultResolver.LookupIP(ctx, "ip6", host)
-		if err != nil || len(ips) == 0 {
-			// Fallback to original dialer if IPv6 is not available
-			return d.Dialer.DialContext(ctx, network, address)
-		}
 
-		// Try IPv6 addresses first
-		for _, ip := range ips {
-			if ip.To4() == nil { // Ensure it's an IPv6 address
-				ipv6Addr := net.JoinHostPort(ip.String(), port)
-				conn, err := d.Dialer.DialContext(ctx, "tcp6", ipv6Addr)
-				if err == nil {
-					return conn, nil
-				}
-			}
-		}
-	}
-
-	// Fallback to original dialer
-	return d.Dialer.DialContext(ctx, network, address)
-}
+	"github.com/vandancd/httpstat/probe"
+)
 
 func main() {
 	// Parse command line flags
@@ -58,12 +25,56 @@ func main() {
 	noKeepAlive := fs.Bool("no-keepalive", false, "Disable keep-alive connections")
 	timeout := fs.Int("timeout", 60, "Timeout in seconds (default: 60)")
 	maxRedirects := fs.Int("max-redirects", 5, "Maximum number of redirects allowed (default: 5, range: 2-10)")
-	dnsServers := fs.String("dns-servers", "", "Comma-separated list of DNS server IP addresses (e.g., 8.8.8.8,8.8.4.4)")
+	dnsStrategy := fs.String("dns-strategy", probe.DNSRoundRobin, "How DNS servers are picked: round-robin, first-healthy or fastest")
+	dnsServers := fs.String("dns-servers", "", "Comma-separated list of DNS servers, IP addresses or udp://, tcp://, tls:// and https:// URIs (e.g., 8.8.8.8,tls://1.1.1.1)")
+	resolveRules := &resolveFlag{}
+	fs.Var(resolveRules, "resolve", "Use addresses for a host and port instead of DNS, host:port:addr[,addr...] (repeatable)")
+	connectTo := &connectToFlag{}
+	fs.Var(connectTo, "connect-to", "Connect to host2:port2 for requests to host:port, host:port:host2:port2 (repeatable)")
 	useIPv6 := fs.Bool("ipv6", false, "Prefer IPv6 connections over IPv4")
+	onlyIPv4 := fs.Bool("ipv4", false, "Only connect over IPv4")
+	onlyIPv6 := fs.Bool("ipv6-only", false, "Only connect over IPv6")
+	fallbackDelay := fs.Duration("fallback-delay", 0, "Happy Eyeballs delay before racing the other IP family (default: 300ms, negative disables)")
+	compareFamilies := fs.Bool("compare-families", false, "Probe over IPv4 and IPv6 and compare the phases")
 	browser := fs.Bool("browser", false, "Use headless browser probe")
+	count := fs.Int("count", 0, "Number of times to repeat the probe (default: 1, unlimited with -duration)")
+	duration := fs.Duration("duration", 0, "Repeat the probe for this long (e.g., 30s)")
+	interval := fs.Duration("interval", 0, "Pause between repeated probes (e.g., 500ms)")
+	concurrency := fs.Int("concurrency", 0, "Number of concurrent workers for load mode")
+	rateFlag := fs.String("rate", "", "Request rate limit for load mode (e.g., 50/s)")
+	output := fs.String("o", "text", "Output format: text, json or har (a single probe only)")
+	caCert := fs.String("cacert", "", "PEM bundle of CA certificates to trust instead of the system roots")
+	clientCert := fs.String("cert", "", "Client certificate, PEM or PKCS#12 (.p12/.pfx)")
+	clientKey := fs.String("key", "", "Private key for a PEM client certificate, if not in the -cert file")
+	certPassword := fs.String("pass", "", "Password for a PKCS#12 client certificate")
+	insecure := fs.Bool("insecure", false, "Skip verification of the server certificate")
+	tlsMin := fs.String("tls-min", "", "Lowest TLS version to offer: 1.0, 1.1, 1.2 or 1.3")
+	tlsMax := fs.String("tls-max", "", "Highest TLS version to offer: 1.0, 1.1, 1.2 or 1.3")
+	ciphers := fs.String("ciphers", "", "Comma-separated list of TLS 1.0-1.2 cipher suites")
+	sni := fs.String("sni", "", "Server name to send in the TLS handshake and verify the certificate against")
+	pins := &pinFlag{}
+	fs.Var(pins, "pin", "Public key pin sha256//BASE64 one certificate of the chain must match (repeatable)")
+	allAddrs := fs.Bool("all-addrs", false, "Probe every address the host resolves to and compare them")
+	resumeTest := fs.Bool("tls-resume-test", false, "Test TLS 1.2 and 1.3 session resumption instead of probing (0-RTT early data is not supported)")
+	certWarnDays := fs.Int("cert-warn-days", 0, "Exit with a warning when a certificate expires within this many days")
+	certCritDays := fs.Int("cert-crit-days", 0, "Exit as critical when a certificate expires within this many days")
+	method := fs.String("X", "", "HTTP method (default: GET, or POST when data is sent)")
+	headers := &headerFlag{header: make(http.Header)}
+	fs.Var(headers, "H", "Request header 'Name: value' (repeatable)")
+	var dataParts []string
+	fs.Var(dataFlag{&dataParts, encodeData}, "d", "Request body data, @file reads it from a file with newlines stripped (repeatable)")
+	fs.Var(dataFlag{&dataParts, encodeDataBinary}, "data-binary", "Request body data, @file reads it from a file as is (repeatable)")
+	fs.Var(dataFlag{&dataParts, encodeDataURLEncode}, "data-urlencode", "URL-encoded request body data: content, name=content or name@file (repeatable)")
+
+	// The tls-scan subcommand takes the same flags as a regular probe
+	args := os.Args[1:]
+	tlsScan := len(args) > 0 && args[0] == "tls-scan"
+	if tlsScan {
+		args = args[1:]
+	}
 
 	// Parse command line arguments
-	url, err := parseCommandLine(fs)
+	url, err := parseCommandLine(fs, args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -75,8 +86,75 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Validate repeat options
+	if *count < 0 {
+		fmt.Fprintf(os.Stderr, "Error: count must not be negative\n")
+		os.Exit(1)
+	}
+
+	// Validate output format
+	if *output != "text" && *output != "json" && *output != "har" {
+		fmt.Fprintf(os.Stderr, "Error: output format must be text, json or har\n")
+		os.Exit(1)
+	}
+
+	// Validate load options
+	if *concurrency < 0 {
+		fmt.Fprintf(os.Stderr, "Error: concurrency must not be negative\n")
+		os.Exit(1)
+	}
+	// Validate certificate check options
+	if *certWarnDays < 0 || *certCritDays < 0 {
+		fmt.Fprintf(os.Stderr, "Error: cert-warn-days and cert-crit-days must not be negative\n")
+		os.Exit(1)
+	}
+	if *certWarnDays > 0 && *certCritDays > *certWarnDays {
+		fmt.Fprintf(os.Stderr, "Error: cert-crit-days must not exceed cert-warn-days\n")
+		os.Exit(1)
+	}
+
+	// Validate IP family options
+	var family string
+	switch {
+	case *onlyIPv4 && (*onlyIPv6 || *useIPv6):
+		fmt.Fprintf(os.Stderr, "Error: ipv4 cannot be combined with ipv6 or ipv6-only\n")
+		os.Exit(1)
+	case *onlyIPv4:
+		family = probe.FamilyIPv4
+	case *onlyIPv6:
+		family = probe.FamilyIPv6
+	}
+	if *compareFamilies && family != "" {
+		fmt.Fprintf(os.Stderr, "Error: compare-families cannot be combined with ipv4 or ipv6-only\n")
+		os.Exit(1)
+	}
+
+	rate, err := parseRate(*rateFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// HAR describes the hops of a single probe, which the other modes do not produce
+	multiRun := tlsScan || *resumeTest || *compareFamilies || *allAddrs ||
+		*concurrency > 0 || rate > 0 || *count > 1 || *duration > 0
+	if *output == "har" && multiRun {
+		fmt.Fprintf(os.Stderr, "Error: -o har only applies to a single probe, not to repeat, load, all-addrs, compare-families, tls-scan or tls-resume-test\n")
+		os.Exit(1)
+	}
+
+	// Validate TLS options and load the certificates they name
+	tlsOpts, err := parseTLSOptions(*caCert, *clientCert, *clientKey, *certPassword, *tlsMin, *tlsMax, *ciphers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tlsOpts.Insecure = *insecure
+	tlsOpts.ServerName = *sni
+	tlsOpts.Pins = pins.pins
+
 	if *browser {
-		err := runBrowserProbe(url)
+		err := runBrowserProbe(url, time.Duration(*timeout)*time.Second, *output)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Browser probe failed: %v\n", err)
 			os.Exit(1)
@@ -84,93 +162,274 @@ func main() {
 		return
 	}
 
+	opts := probe.Options{
+		URL:           url,
+		HTTP1:         *http1,
+		HTTP11:        *http11,
+		NoKeepAlive:   *noKeepAlive,
+		Timeout:       time.Duration(*timeout) * time.Second,
+		MaxRedirects:  *maxRedirects,
+		Resolve:       resolveRules.rules,
+		ConnectTo:     connectTo.rules,
+		PreferIPv6:    *useIPv6,
+		FallbackDelay: *fallbackDelay,
+		IPFamily:      family,
+		Method:        *method,
+		Header:        headers.header,
+		TLS:           tlsOpts,
+		CertWarnDays:  *certWarnDays,
+		CertCritDays:  *certCritDays,
+	}
+
+	applyData(&opts, dataParts)
+
 	// Set up DNS resolver if custom servers are provided
 	if *dnsServers != "" {
 		servers := strings.Split(*dnsServers, ",")
 		for i, server := range servers {
 			servers[i] = strings.TrimSpace(server)
 		}
-		resolver = createCustomResolver(servers)
+		opts.DNSServers = servers
+		opts.DNSStrategy = *dnsStrategy
 	}
 
-	// Create base dialer
-	baseDialer := &net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-		Resolver:  resolver,
-		DualStack: !*useIPv6, // Disable dual stack (Happy Eyeballs) when IPv6 is preferred
+	p, err := probe.New(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Enumerate what the server accepts instead of probing
+	if tlsScan {
+		scan, err := p.TLSScan(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printResults(*output, scan, scan.JSON())
+		return
+	}
+
+	// Test session resumption instead of probing
+	if *resumeTest {
+		resume, err := p.ResumeTest(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printResults(*output, resume, resume.JSON())
+		return
+	}
+
+	// Probe over both families and compare them
+	if *compareFamilies {
+		comparison, err := p.CompareFamilies(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printResults(*output, comparison, comparison.JSON())
+		return
 	}
 
-	// Create custom dialer with IPv6 preference
-	dialer := &customDialer{
-		Dialer:     baseDialer,
-		preferIPv6: *useIPv6,
+	// Probe every address of the host and compare them
+	if *allAddrs {
+		all, err := p.AllAddrs(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printResults(*output, all, all.JSON())
+		if all.Failed() {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Create transport and initialize tracking variables
-	transport := createTransport(*http1, *http11, *noKeepAlive, dialer.DialContext)
-	url = normalizeURL(url)
-	redirects := make([]RedirectInfo, 0)
-	var finalTiming Timing
+	// Drive the probe from a worker pool in load mode
+	if *concurrency > 0 || rate > 0 {
+		loadOpts := probe.LoadOptions{
+			Concurrency: *concurrency,
+			Rate:        rate,
+			Count:       *count,
+			Duration:    *duration,
+		}
+		if loadOpts.Count == 0 && loadOpts.Duration == 0 {
+			loadOpts.Duration = defaultLoadDuration
+		}
+		load := p.Load(context.Background(), loadOpts)
+		printResults(*output, load, load.JSON())
+		if load.Errors > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Create HTTP client
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   time.Duration(*timeout) * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return handleRedirect(req, via, &redirects, *maxRedirects)
-		},
+	// Repeat the probe and report statistics when asked for more than one sample
+	if *count > 1 || *duration > 0 {
+		repeat := p.Repeat(context.Background(), probe.RepeatOptions{
+			Count:    *count,
+			Duration: *duration,
+			Interval: *interval,
+		})
+		printResults(*output, repeat, repeat.JSON())
+		if len(repeat.Results) == 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Create and execute request
-	req, err := createRequest(url, &finalTiming)
+	result, err := p.Run(context.Background())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating request: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		// A certificate that fails verification outright is critical
+		var verifyErr *tls.CertificateVerificationError
+		if (*certWarnDays > 0 || *certCritDays > 0) && errors.As(err, &verifyErr) {
+			os.Exit(exitCertCritical)
+		}
 		os.Exit(1)
 	}
 
-	// Execute request and process response
-	start := time.Now()
-	resp, err := client.Do(req)
+	// Print results
+	printResult(*output, result)
+
+	if result.CertCheck != nil {
+		switch result.CertCheck.Status {
+		case probe.SeverityWarning:
+			os.Exit(exitCertWarning)
+		case probe.SeverityCritical:
+			os.Exit(exitCertCritical)
+		}
+	}
+}
+
+// Exit codes for certificate checks; 1 is used for every other error
+const (
+	exitCertWarning  = 2
+	exitCertCritical = 3
+)
+
+// printResult prints the result of a single probe in the requested format
+func printResult(output string, result *probe.Result) {
+	if output == "har" {
+		printResults("json", result, result.HAR())
+		return
+	}
+	printResults(output, result, result.JSON())
+}
+
+// textRenderer is implemented by results that can render themselves as text
+type textRenderer interface {
+	WriteText(w io.Writer, color bool) error
+}
+
+// printResults prints results in the requested output format
+func printResults(output string, text textRenderer, v interface{}) {
+	if output == "text" {
+		if err := text.WriteText(os.Stdout, useColor()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		}
+		return
+	}
+
+	jsonData, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error making request: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
+		return
 	}
-	defer resp.Body.Close()
+	fmt.Println(string(jsonData))
+}
 
-	// Process response body and timing
-	bodyStart := time.Now()
-	if err := processResponseBody(resp, &finalTiming, bodyStart, start); err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing response: %v\n", err)
-		os.Exit(1)
+// useColor reports whether text output should be colored: only on a
+// terminal, and never when NO_COLOR is set
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Print results
-	printResults(resp, redirects, finalTiming)
+// defaultLoadDuration bounds load mode when neither -count nor -duration is set
+const defaultLoadDuration = 10 * time.Second
 
-	/*dnsTraceErr := traceDNS("www.vandan.com")
-	if dnsTraceErr != nil {
-		fmt.Fprintf(os.Stderr, "DNS trace failed: %v\n", err)
-	}*/
+// parseRate parses a request rate such as "50" or "50/s"
+func parseRate(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(s, "/s"), 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected requests per second such as 50/s", s)
+	}
+	return rate, nil
 }
 
-func parseCommandLine(fs *flag.FlagSet) (string, error) {
-	var url string
-	var args []string
-	for _, arg := range os.Args[1:] {
-		if !strings.HasPrefix(arg, "-") {
-			url = arg
-		} else {
-			args = append(args, arg)
+// parseTLSOptions loads the certificate files and parses the versions and
+// cipher suites given on the command line
+func parseTLSOptions(caCert, clientCert, clientKey, password, tlsMin, tlsMax, ciphers string) (probe.TLSOptions, error) {
+	var opts probe.TLSOptions
+	var err error
+
+	if caCert != "" {
+		if opts.RootCAs, err = probe.LoadCACerts(caCert); err != nil {
+			return opts, err
 		}
 	}
+	if clientKey != "" && clientCert == "" {
+		return opts, fmt.Errorf("-key requires -cert")
+	}
+	if clientCert != "" {
+		certificate, err := probe.LoadClientCertificate(clientCert, clientKey, password)
+		if err != nil {
+			return opts, err
+		}
+		opts.Certificates = []tls.Certificate{certificate}
+	}
+
+	if tlsMin != "" {
+		if opts.MinVersion, err = probe.ParseTLSVersion(tlsMin); err != nil {
+			return opts, err
+		}
+	}
+	if tlsMax != "" {
+		if opts.MaxVersion, err = probe.ParseTLSVersion(tlsMax); err != nil {
+			return opts, err
+		}
+	}
+	if opts.MinVersion != 0 && opts.MaxVersion != 0 && opts.MinVersion > opts.MaxVersion {
+		return opts, fmt.Errorf("tls-min must not be above tls-max")
+	}
 
-	if err := fs.Parse(args); err != nil {
-		return "", fmt.Errorf("error parsing flags: %v", err)
+	if ciphers != "" {
+		if opts.CipherSuites, err = probe.ParseCipherSuites(ciphers); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func parseCommandLine(fs *flag.FlagSet, args []string) (string, error) {
+	var url string
+
+	// Flags may appear before or after the URL, so keep parsing past each
+	// positional argument
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", fmt.Errorf("error parsing flags: %v", err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		url = fs.Arg(0)
+		args = fs.Args()[1:]
 	}
 
 	if url == "" {
-		return "", fmt.Errorf("usage: %s [--http1 | --http1.1 | --http2] [--no-keepalive] [--timeout seconds] [--max-redirects count] [--dns-servers server1,server2] <url>", os.Args[0])
+		return "", fmt.Errorf("usage: %s [tls-scan] [--http1 | --http1.1 | --http2] [--no-keepalive] [--timeout seconds] [--max-redirects count] [--dns-servers server1,server2] [--dns-strategy s] [--resolve host:port:addr] [--connect-to host:port:host2:port2] [--count n | --duration d] [--interval d] [--concurrency c] [--rate r/s] [-X method] [-H 'Name: value'] [-d data] [-o text|json|har] [--cacert file] [--cert file [--key file] [--pass password]] [--insecure] [--tls-min v] [--tls-max v] [--ciphers list] [--sni name] [--pin sha256//hash] [--tls-resume-test] [--all-addrs] [--ipv4 | --ipv6 | --ipv6-only] [--fallback-delay d] [--compare-families] [--cert-warn-days n] [--cert-crit-days n] <url>", os.Args[0])
 	}
 
 	return url, nil
@@ -0,0 +1,227 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// An address is an outlier in a phase when it takes over outlierFactor
+// times the median of all addresses, and at least outlierMinDelta longer
+const (
+	outlierFactor   = 2.0
+	outlierMinDelta = 10 * time.Millisecond
+)
+
+// AddrResult is the probe of one address of the URL's host
+type AddrResult struct {
+	Addr     string
+	Result   *Result // Nil if the probe failed
+	Err      error
+	Outliers []string // Why the address stands out from the others
+}
+
+// AllAddrsResult holds a probe of every address the URL's host resolves to
+type AllAddrsResult struct {
+	URL   string
+	Host  string
+	Addrs []AddrResult
+}
+
+// AllAddrs resolves the URL's host and probes each address in turn, with a
+// fresh connection and the same URL, Host header and TLS server name. Every
+// hop to the URL's host and port is pinned to the address, including
+// redirects back to it, while redirects to other hosts resolve as usual.
+// The results are then compared to flag outliers.
+func (p *Probe) AllAddrs(ctx context.Context) (*AllAddrsResult, error) {
+	u, err := url.Parse(p.opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	// Rules the dialer would apply pick the host that actually gets resolved
+	host := u.Hostname()
+	var addrs []string
+	override, err := p.overrides.apply(net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if override != nil && override.ConnectTo != "" {
+		host, port, _ = net.SplitHostPort(override.ConnectTo)
+	}
+	if override != nil && len(override.Resolve) > 0 {
+		for _, addr := range override.Resolve {
+			ip, _, _ := net.SplitHostPort(addr)
+			addrs = append(addrs, ip)
+		}
+	} else {
+		network := "ip"
+		switch p.opts.IPFamily {
+		case FamilyIPv4:
+			network = "ip4"
+		case FamilyIPv6:
+			network = "ip6"
+		}
+		ips, err := p.resolver.LookupIP(ctx, network, host)
+		if err != nil {
+			return nil, &PhaseError{Phase: PhaseDNS, Err: err}
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, ip.String())
+		}
+	}
+
+	result := &AllAddrsResult{URL: p.opts.URL, Host: net.JoinHostPort(host, port)}
+	for _, addr := range addrs {
+		if ctx.Err() != nil {
+			break
+		}
+		opts := p.opts
+		opts.Resolve = append([]ResolveRule{{Host: host, Port: port, Addrs: []string{addr}}}, p.opts.Resolve...)
+		probe, err := New(opts)
+		if err != nil {
+			return nil, err
+		}
+		r, err := probe.Run(ctx)
+		result.Addrs = append(result.Addrs, AddrResult{Addr: addr, Result: r, Err: err})
+	}
+	result.flagOutliers()
+	return result, nil
+}
+
+// flagOutliers marks addresses that failed while others succeeded, returned
+// a different status than most, or were much slower than the median in a
+// phase of the first hop or in total
+func (r *AllAddrsResult) flagOutliers() {
+	var ok []*AddrResult
+	statuses := make(map[int]int)
+	for i := range r.Addrs {
+		if a := &r.Addrs[i]; a.Result != nil {
+			ok = append(ok, a)
+			statuses[a.Result.StatusCode]++
+		}
+	}
+	if len(ok) == 0 {
+		return
+	}
+
+	common := 0
+	for status, n := range statuses {
+		if n > statuses[common] || (n == statuses[common] && status < common) {
+			common = status
+		}
+	}
+	for i := range r.Addrs {
+		if r.Addrs[i].Err != nil {
+			r.Addrs[i].Outliers = append(r.Addrs[i].Outliers, "failed")
+		}
+	}
+	for _, a := range ok {
+		if a.Result.StatusCode != common {
+			a.Outliers = append(a.Outliers, fmt.Sprintf("status %d, others %d", a.Result.StatusCode, common))
+		}
+	}
+	if len(ok) < 2 {
+		return
+	}
+
+	for _, phase := range addrPhases {
+		values := make([]time.Duration, len(ok))
+		for i, a := range ok {
+			values[i] = phase.value(a.Result)
+		}
+		median := medianDuration(values)
+		for i, a := range ok {
+			if values[i] > time.Duration(outlierFactor*float64(median)) && values[i]-median >= outlierMinDelta {
+				a.Outliers = append(a.Outliers, fmt.Sprintf("%s %s, median %s", phase.name, FormatDuration(values[i]), FormatDuration(median)))
+			}
+		}
+	}
+}
+
+// addrPhases are the phases compared between addresses
+var addrPhases = []struct {
+	name  string
+	value func(*Result) time.Duration
+}{
+	{"connect", func(r *Result) time.Duration { return r.FirstHop().TCPConnection }},
+	{"tls", func(r *Result) time.Duration { return r.FirstHop().TLSHandshake }},
+	{"ttfb", func(r *Result) time.Duration { return r.FirstHop().ServerProcessing }},
+	{"total", (*Result).TotalTime},
+}
+
+// medianDuration returns the median of values
+func medianDuration(values []time.Duration) time.Duration {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Failed reports whether the probe of any address failed
+func (r *AllAddrsResult) Failed() bool {
+	for _, a := range r.Addrs {
+		if a.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AddrJSON represents the probe of one address in JSON format
+type AddrJSON struct {
+	Addr       string        `json:"addr"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Connect    string        `json:"connect,omitempty"`
+	TLS        string        `json:"tls,omitempty"`
+	TTFB       string        `json:"ttfb,omitempty"`
+	Total      string        `json:"total,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	ErrorPhase string        `json:"error_phase,omitempty"`
+	Outliers   []string      `json:"outliers,omitempty"`
+	Result     *ResponseJSON `json:"result,omitempty"`
+}
+
+// AllAddrsJSON represents the probes of every address in JSON format
+type AllAddrsJSON struct {
+	URL   string     `json:"url"`
+	Host  string     `json:"host"`
+	Addrs []AddrJSON `json:"addrs"`
+}
+
+// JSON converts the probes into their JSON representation
+func (r *AllAddrsResult) JSON() AllAddrsJSON {
+	result := AllAddrsJSON{URL: r.URL, Host: r.Host, Addrs: make([]AddrJSON, 0, len(r.Addrs))}
+	for _, a := range r.Addrs {
+		addr := AddrJSON{Addr: a.Addr, Outliers: a.Outliers}
+		if a.Err != nil {
+			addr.Error = a.Err.Error()
+			addr.ErrorPhase = ErrorPhase(a.Err)
+		}
+		if a.Result != nil {
+			first := a.Result.FirstHop()
+			response := a.Result.JSON()
+			addr.StatusCode = a.Result.StatusCode
+			addr.Connect = FormatDuration(first.TCPConnection)
+			addr.TLS = FormatDuration(first.TLSHandshake)
+			addr.TTFB = FormatDuration(first.ServerProcessing)
+			addr.Total = FormatDuration(a.Result.TotalTime())
+			addr.Result = &response
+		}
+		result.Addrs = append(result.Addrs, addr)
+	}
+	return result
+}
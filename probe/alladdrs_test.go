@@ -0,0 +1,89 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pathRecorder is a test server that records the paths it was asked for
+type pathRecorder struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *pathRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.paths...)
+}
+
+// newPathRecorder starts a server on addr that redirects / to /final on the
+// same host
+func newPathRecorder(t *testing.T, addr string) *pathRecorder {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	r := &pathRecorder{}
+	r.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.paths = append(r.paths, req.URL.Path)
+		r.mu.Unlock()
+		if req.URL.Path == "/" {
+			http.Redirect(w, req, "/final", http.StatusFound)
+		}
+	}))
+	r.Listener.Close()
+	r.Listener = ln
+	r.Start()
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestAllAddrsPinsRedirectsToSameHost(t *testing.T) {
+	first := newPathRecorder(t, "127.0.0.1:0")
+	port := mustPort(t, first.URL)
+	second := newPathRecorder(t, "127.0.0.2:"+port)
+
+	p, err := New(Options{
+		URL:     "http://addrs.test:" + port + "/",
+		Timeout: 5 * time.Second,
+		Resolve: []ResolveRule{{Host: "addrs.test", Port: port, Addrs: []string{"127.0.0.1", "127.0.0.2"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := p.AllAddrs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Addrs) != 2 {
+		t.Fatalf("probed %d addresses, want 2", len(all.Addrs))
+	}
+
+	for i, server := range []*pathRecorder{first, second} {
+		a := all.Addrs[i]
+		if a.Err != nil {
+			t.Fatalf("probe of %s failed: %v", a.Addr, a.Err)
+		}
+		if got := server.recorded(); len(got) != 2 || got[0] != "/" || got[1] != "/final" {
+			t.Errorf("server at %s saw %v, want the first hop and the redirect", a.Addr, got)
+		}
+		if len(a.Result.Redirects) != 1 {
+			t.Fatalf("probe of %s followed %d redirects, want 1", a.Addr, len(a.Result.Redirects))
+		}
+		want := net.JoinHostPort(a.Addr, port)
+		if got := a.Result.Redirects[0].RemoteAddr; got != want {
+			t.Errorf("first hop of %s connected to %s, want %s", a.Addr, got, want)
+		}
+		if got := a.Result.RemoteAddr; got != want {
+			t.Errorf("redirect of %s connected to %s, want %s", a.Addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package probe
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Certificate check severities, from least to most severe
+const (
+	SeverityOK       = "ok"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Certificate checks
+const (
+	CheckExpiry    = "expiry"
+	CheckHostname  = "hostname"
+	CheckChain     = "chain"
+	CheckSignature = "signature"
+)
+
+// CertIssue is a problem found with the certificates of one hop
+type CertIssue struct {
+	URL      string
+	Check    string
+	Severity string
+	Position int // Position in the peer chain, leaf first, -1 for the whole chain
+	Message  string
+}
+
+// CertCheck holds the outcome of checking the certificates of every hop
+type CertCheck struct {
+	Status string // Most severe issue, SeverityOK if there are none
+	Issues []CertIssue
+}
+
+// severityRank orders severities so the worst one can be picked
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	}
+	return 0
+}
+
+// add records an issue and raises the status to its severity
+func (c *CertCheck) add(issue CertIssue) {
+	c.Issues = append(c.Issues, issue)
+	if severityRank(issue.Severity) > severityRank(c.Status) {
+		c.Status = issue.Severity
+	}
+}
+
+// checkCertificates checks the chain of every TLS hop of a result for
+// expiry within warnDays or critDays, hostname mismatches, incomplete
+// chains and weak signatures. Chains are verified against roots, or the
+// system roots when nil.
+func checkCertificates(r *Result, warnDays, critDays int, roots *x509.CertPool, now time.Time) *CertCheck {
+	check := &CertCheck{Status: SeverityOK}
+	for _, redirect := range r.Redirects {
+		checkHop(check, redirect.URL, redirect.TLS, warnDays, critDays, roots, now)
+	}
+	checkHop(check, r.URL, r.TLS, warnDays, critDays, roots, now)
+	return check
+}
+
+// checkHop checks the certificates of a single hop
+func checkHop(check *CertCheck, rawURL string, info *TLSInfo, warnDays, critDays int, roots *x509.CertPool, now time.Time) {
+	if info == nil || len(info.PeerCertificates) == 0 {
+		return
+	}
+	chain := info.PeerCertificates
+	leaf := chain[0]
+	issue := func(name, severity string, position int, format string, args ...interface{}) {
+		check.add(CertIssue{
+			URL:      rawURL,
+			Check:    name,
+			Severity: severity,
+			Position: position,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Expiry of the leaf and intermediates; a self-signed root sent along
+	// with the chain is ignored, as clients use their own copy
+	for i, cert := range chain {
+		if i > 0 && isSelfSigned(cert) {
+			continue
+		}
+		days := int(cert.NotAfter.Sub(now).Hours() / 24)
+		switch {
+		case now.After(cert.NotAfter):
+			issue(CheckExpiry, SeverityCritical, i, "%s expired on %s", cert.Subject, cert.NotAfter.Format("2006-01-02"))
+		case now.Before(cert.NotBefore):
+			issue(CheckExpiry, SeverityCritical, i, "%s is not valid before %s", cert.Subject, cert.NotBefore.Format("2006-01-02"))
+		case critDays > 0 && days < critDays:
+			issue(CheckExpiry, SeverityCritical, i, "%s expires in %d days", cert.Subject, days)
+		case warnDays > 0 && days < warnDays:
+			issue(CheckExpiry, SeverityWarning, i, "%s expires in %d days", cert.Subject, days)
+		}
+	}
+
+	// The leaf must match the name the client asked for
+	host := info.ServerName
+	if host == "" {
+		if u, err := url.Parse(rawURL); err == nil {
+			host = u.Hostname()
+		}
+	}
+	if err := leaf.VerifyHostname(host); err != nil {
+		issue(CheckHostname, SeverityCritical, 0, "%v", err)
+	}
+
+	// The server must send every intermediate needed to reach a trusted root
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	var unknownAuthority x509.UnknownAuthorityError
+	switch {
+	case err != nil && hasWeakSignature(chain):
+		// Go does not verify weak signatures, which are reported below
+	case errors.As(err, &unknownAuthority) && isSelfSigned(chain[len(chain)-1]):
+		issue(CheckChain, SeverityCritical, -1, "chain ends in an untrusted root: %s", chain[len(chain)-1].Subject)
+	case errors.As(err, &unknownAuthority):
+		issue(CheckChain, SeverityCritical, -1, "incomplete chain: no path from %s to a trusted root", chain[len(chain)-1].Issuer)
+	case err != nil && !errors.As(err, new(x509.CertificateInvalidError)):
+		issue(CheckChain, SeverityCritical, -1, "chain verification failed: %v", err)
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		err := chain[i].CheckSignatureFrom(chain[i+1])
+		if err != nil && !errors.As(err, new(x509.InsecureAlgorithmError)) {
+			issue(CheckChain, SeverityWarning, i, "%s is not signed by the next certificate in the chain", chain[i].Subject)
+		}
+	}
+
+	// Weak signatures and keys on anything other than a self-signed root
+	for i, cert := range chain {
+		if i > 0 && isSelfSigned(cert) {
+			continue
+		}
+		if isWeakSignature(cert) {
+			issue(CheckSignature, SeverityCritical, i, "%s is signed with weak algorithm %s", cert.Subject, cert.SignatureAlgorithm)
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < 2048 {
+			issue(CheckSignature, SeverityWarning, i, "%s has a weak %d-bit RSA key", cert.Subject, key.N.BitLen())
+		}
+	}
+}
+
+// isWeakSignature reports whether cert is signed with MD2, MD5 or SHA-1
+func isWeakSignature(cert *x509.Certificate) bool {
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// hasWeakSignature reports whether a certificate of the chain other than a
+// self-signed root is signed with a weak algorithm
+func hasWeakSignature(chain []*x509.Certificate) bool {
+	for i, cert := range chain {
+		if (i == 0 || !isSelfSigned(cert)) && isWeakSignature(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelfSigned reports whether cert is signed by its own key
+func isSelfSigned(cert *x509.Certificate) bool {
+	return cert.Subject.String() == cert.Issuer.String() && cert.CheckSignatureFrom(cert) == nil
+}
+
+// CertIssueJSON represents a certificate issue in JSON format
+type CertIssueJSON struct {
+	URL      string `json:"url"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Position int    `json:"position"`
+	Message  string `json:"message"`
+}
+
+// CertCheckJSON represents the certificate checks in JSON format
+type CertCheckJSON struct {
+	Status string          `json:"status"`
+	Issues []CertIssueJSON `json:"issues"`
+}
+
+// JSON converts the certificate checks into their JSON representation
+func (c *CertCheck) JSON() *CertCheckJSON {
+	if c == nil {
+		return nil
+	}
+	result := &CertCheckJSON{Status: c.Status, Issues: make([]CertIssueJSON, 0, len(c.Issues))}
+	for _, issue := range c.Issues {
+		result.Issues = append(result.Issues, CertIssueJSON(issue))
+	}
+	return result
+}
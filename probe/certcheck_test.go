@@ -0,0 +1,182 @@
+package probe
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// certCheckNow is the fixed time certificates are checked at
+var certCheckNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// certCheckChain is a root, intermediate and leaf valid at certCheckNow.
+// The leaf is valid for leafValid from then, modify can change its template
+// and key is its key, a new P-256 key when nil.
+func certCheckChain(t *testing.T, leafValid time.Duration, modify func(*x509.Certificate), key crypto.Signer) testChain {
+	t.Helper()
+	validity := func(template *x509.Certificate, d time.Duration) *x509.Certificate {
+		template.NotBefore = certCheckNow.Add(-30 * 24 * time.Hour)
+		template.NotAfter = certCheckNow.Add(d)
+		return template
+	}
+	root := issueCert(t, validity(caTemplate("Test Root"), 10*365*24*time.Hour), nil, nil)
+	intermediate := issueCert(t, validity(caTemplate("Test Intermediate"), 5*365*24*time.Hour), root, nil)
+	template := validity(leafTemplate(), leafValid)
+	if modify != nil {
+		modify(template)
+	}
+	return testChain{leaf: issueCert(t, template, intermediate, key), intermediate: intermediate, root: root}
+}
+
+// issueKeys lists the check, severity and position of each issue, sorted
+func issueKeys(check *CertCheck) []string {
+	keys := make([]string, 0, len(check.Issues))
+	for _, issue := range check.Issues {
+		keys = append(keys, fmt.Sprintf("%s/%s/%d", issue.Check, issue.Severity, issue.Position))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCheckCertificates(t *testing.T) {
+	const day = 24 * time.Hour
+	const warnDays, critDays = 30, 7
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		leafValid  time.Duration
+		modify     func(*x509.Certificate)
+		key        crypto.Signer
+		sent       func(testChain) []*x509.Certificate // Chain sent by the server, leaf and intermediate when nil
+		url        string                              // https://pin.test/ when empty
+		serverName string
+		wantStatus string
+		wantIssues []string
+	}{
+		{name: "valid", leafValid: 90 * day, wantStatus: SeverityOK},
+		{name: "on the warn day", leafValid: warnDays * day, wantStatus: SeverityOK},
+		{name: "within the warn days", leafValid: warnDays*day - time.Second, wantStatus: SeverityWarning,
+			wantIssues: []string{"expiry/warning/0"}},
+		{name: "on the crit day", leafValid: critDays * day, wantStatus: SeverityWarning,
+			wantIssues: []string{"expiry/warning/0"}},
+		{name: "within the crit days", leafValid: critDays*day - time.Second, wantStatus: SeverityCritical,
+			wantIssues: []string{"expiry/critical/0"}},
+		{name: "expires today", leafValid: time.Hour, wantStatus: SeverityCritical,
+			wantIssues: []string{"expiry/critical/0"}},
+		{name: "expired", leafValid: -time.Second, wantStatus: SeverityCritical,
+			wantIssues: []string{"expiry/critical/0"}},
+		{
+			name:      "not yet valid",
+			leafValid: 90 * day,
+			modify: func(c *x509.Certificate) {
+				c.NotBefore = certCheckNow.Add(time.Hour)
+			},
+			wantStatus: SeverityCritical,
+			wantIssues: []string{"expiry/critical/0"},
+		},
+		{name: "hostname mismatch", leafValid: 90 * day, url: "https://other.test/", wantStatus: SeverityCritical,
+			wantIssues: []string{"hostname/critical/0"}},
+		{name: "server name checked instead of the URL host", leafValid: 90 * day, url: "https://other.test/", serverName: "pin.test",
+			wantStatus: SeverityOK},
+		{
+			name:       "incomplete chain",
+			leafValid:  90 * day,
+			sent:       func(c testChain) []*x509.Certificate { return []*x509.Certificate{c.leaf.Certificate} },
+			wantStatus: SeverityCritical,
+			wantIssues: []string{"chain/critical/-1"},
+		},
+		{
+			name:      "root sent along",
+			leafValid: 90 * day,
+			sent: func(c testChain) []*x509.Certificate {
+				return []*x509.Certificate{c.leaf.Certificate, c.intermediate.Certificate, c.root.Certificate}
+			},
+			wantStatus: SeverityOK,
+		},
+		{
+			name:      "SHA-1 signature",
+			leafValid: 90 * day,
+			modify: func(c *x509.Certificate) {
+				c.SignatureAlgorithm = x509.ECDSAWithSHA1
+			},
+			wantStatus: SeverityCritical,
+			wantIssues: []string{"signature/critical/0"},
+		},
+		{
+			name:       "1024-bit RSA key",
+			leafValid:  90 * day,
+			key:        weakKey,
+			wantStatus: SeverityWarning,
+			wantIssues: []string{"signature/warning/0"},
+		},
+		{
+			name:       "worst severity wins",
+			leafValid:  warnDays*day - time.Second,
+			url:        "https://other.test/",
+			wantStatus: SeverityCritical,
+			wantIssues: []string{"expiry/warning/0", "hostname/critical/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := certCheckChain(t, tt.leafValid, tt.modify, tt.key)
+			sent := []*x509.Certificate{chain.leaf.Certificate, chain.intermediate.Certificate}
+			if tt.sent != nil {
+				sent = tt.sent(chain)
+			}
+			url := tt.url
+			if url == "" {
+				url = "https://pin.test/"
+			}
+			result := &Result{URL: url, TLS: &TLSInfo{ServerName: tt.serverName, PeerCertificates: sent}}
+
+			check := checkCertificates(result, warnDays, critDays, chain.roots(), certCheckNow)
+			if check.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s (issues %+v)", check.Status, tt.wantStatus, check.Issues)
+			}
+			if got := issueKeys(check); fmt.Sprint(got) != fmt.Sprint(tt.wantIssues) {
+				t.Errorf("issues = %v, want %v (%+v)", got, tt.wantIssues, check.Issues)
+			}
+		})
+	}
+}
+
+func TestCheckCertificatesEveryHop(t *testing.T) {
+	const day = 24 * time.Hour
+	expiring := certCheckChain(t, 10*day, nil, nil)
+	valid := certCheckChain(t, 90*day, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(expiring.root.Certificate)
+	roots.AddCert(valid.root.Certificate)
+
+	// The redirect's certificate raises the status even though the final
+	// hop's is fine, and plain HTTP hops are skipped
+	result := &Result{
+		URL: "https://pin.test/final",
+		TLS: &TLSInfo{PeerCertificates: []*x509.Certificate{valid.leaf.Certificate, valid.intermediate.Certificate}},
+		Redirects: []RedirectInfo{
+			{URL: "http://pin.test/"},
+			{URL: "https://pin.test/", TLS: &TLSInfo{PeerCertificates: []*x509.Certificate{expiring.leaf.Certificate, expiring.intermediate.Certificate}}},
+		},
+	}
+	check := checkCertificates(result, 30, 7, roots, certCheckNow)
+	if check.Status != SeverityWarning || len(check.Issues) != 1 || check.Issues[0].URL != "https://pin.test/" {
+		t.Errorf("check = %+v, want one warning for the redirect", check)
+	}
+
+	// Without thresholds expiry is only checked against the validity period
+	check = checkCertificates(result, 0, 0, roots, certCheckNow)
+	if check.Status != SeverityOK || len(check.Issues) != 0 {
+		t.Errorf("check without thresholds = %+v, want no issues", check)
+	}
+}
@@ -0,0 +1,97 @@
+package probe
+
+import "time"
+
+// ConnectAttempt is one connection attempt of a hop. Happy Eyeballs races
+// attempts to both families, so a hop may have several, in parallel.
+type ConnectAttempt struct {
+	Addr     string
+	Family   string        // FamilyIPv4 or FamilyIPv6
+	Start    time.Duration // Offset from the hop's first attempt
+	Duration time.Duration
+	Error    string
+	Winner   bool // Attempt whose connection was used
+}
+
+// pendingAttempt is a connection attempt that has not completed yet
+type pendingAttempt struct {
+	index   int
+	started time.Time
+}
+
+// connectRace tracks the connection attempts of one hop. The connect phase
+// runs from the first attempt's start to the winner's completion, or to the
+// last failure when every attempt failed.
+type connectRace struct {
+	first    time.Time
+	attempts []ConnectAttempt
+	pending  map[string][]pendingAttempt // Attempts in progress, by address
+	winner   bool
+}
+
+// start records an attempt to addr starting at now
+func (c *connectRace) start(addr string, now time.Time) {
+	if c.first.IsZero() {
+		c.first = now
+	}
+	if c.pending == nil {
+		c.pending = make(map[string][]pendingAttempt)
+	}
+	c.pending[addr] = append(c.pending[addr], pendingAttempt{index: len(c.attempts), started: now})
+	c.attempts = append(c.attempts, ConnectAttempt{Addr: addr, Family: familyOf(addr), Start: now.Sub(c.first)})
+}
+
+// done records the completion of the oldest pending attempt to addr. It
+// returns the connect phase duration and true when the phase was extended:
+// by the first success, or by a failure while there is no winner yet.
+func (c *connectRace) done(addr string, err error, now time.Time) (time.Duration, bool) {
+	pending := c.pending[addr]
+	if len(pending) == 0 {
+		return 0, false
+	}
+	p := pending[0]
+	c.pending[addr] = pending[1:]
+
+	attempt := &c.attempts[p.index]
+	attempt.Duration = now.Sub(p.started)
+	if err != nil {
+		attempt.Error = err.Error()
+		return now.Sub(c.first), !c.winner
+	}
+	if c.winner {
+		return 0, false
+	}
+	c.winner = true
+	attempt.Winner = true
+	return now.Sub(c.first), true
+}
+
+// ConnectAttemptJSON represents a connection attempt in JSON format
+type ConnectAttemptJSON struct {
+	Addr     string `json:"addr"`
+	Family   string `json:"family,omitempty"`
+	Start    string `json:"start_offset"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	Winner   bool   `json:"winner"`
+}
+
+// connectAttemptsJSON converts connection attempts into their JSON
+// representation
+func connectAttemptsJSON(attempts []ConnectAttempt) []ConnectAttemptJSON {
+	if len(attempts) == 0 {
+		return nil
+	}
+	result := make([]ConnectAttemptJSON, 0, len(attempts))
+	for _, a := range attempts {
+		result = append(result, ConnectAttemptJSON{
+			Addr:     a.Addr,
+			Family:   a.Family,
+			Start:    formatDelta(a.Start),
+			Duration: FormatDuration(a.Duration),
+			Error:    a.Error,
+			Winner:   a.Winner,
+		})
+	}
+	return result
+}
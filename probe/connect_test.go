@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectRace(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	refused := errors.New("connection refused")
+
+	type step struct {
+		addr         string
+		start        bool
+		err          error
+		ms           int
+		wantElapsed  time.Duration
+		wantExtended bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []ConnectAttempt
+	}{
+		{
+			name: "failure then success",
+			steps: []step{
+				{addr: "[2001:db8::1]:443", start: true, ms: 0},
+				{addr: "[2001:db8::1]:443", err: refused, ms: 20, wantElapsed: 20 * time.Millisecond, wantExtended: true},
+				{addr: "192.0.2.1:443", start: true, ms: 20},
+				{addr: "192.0.2.1:443", ms: 30, wantElapsed: 30 * time.Millisecond, wantExtended: true},
+			},
+			want: []ConnectAttempt{
+				{Addr: "[2001:db8::1]:443", Family: FamilyIPv6, Duration: 20 * time.Millisecond, Error: "connection refused"},
+				{Addr: "192.0.2.1:443", Family: FamilyIPv4, Start: 20 * time.Millisecond, Duration: 10 * time.Millisecond, Winner: true},
+			},
+		},
+		{
+			name: "loser completes after the winner",
+			steps: []step{
+				{addr: "[2001:db8::1]:443", start: true, ms: 0},
+				{addr: "192.0.2.1:443", start: true, ms: 300},
+				{addr: "192.0.2.1:443", ms: 310, wantElapsed: 310 * time.Millisecond, wantExtended: true},
+				// The losing success does not move the end of the connect phase
+				{addr: "[2001:db8::1]:443", ms: 320},
+			},
+			want: []ConnectAttempt{
+				{Addr: "[2001:db8::1]:443", Family: FamilyIPv6, Duration: 320 * time.Millisecond},
+				{Addr: "192.0.2.1:443", Family: FamilyIPv4, Start: 300 * time.Millisecond, Duration: 10 * time.Millisecond, Winner: true},
+			},
+		},
+		{
+			name: "loser cancelled after the winner",
+			steps: []step{
+				{addr: "192.0.2.1:443", start: true, ms: 0},
+				{addr: "[2001:db8::1]:443", start: true, ms: 300},
+				{addr: "192.0.2.1:443", ms: 305, wantElapsed: 305 * time.Millisecond, wantExtended: true},
+				{addr: "[2001:db8::1]:443", err: context.Canceled, ms: 306, wantElapsed: 306 * time.Millisecond},
+			},
+			want: []ConnectAttempt{
+				{Addr: "192.0.2.1:443", Family: FamilyIPv4, Duration: 305 * time.Millisecond, Winner: true},
+				{Addr: "[2001:db8::1]:443", Family: FamilyIPv6, Start: 300 * time.Millisecond, Duration: 6 * time.Millisecond, Error: context.Canceled.Error()},
+			},
+		},
+		{
+			name: "attempts to the same address complete in order",
+			steps: []step{
+				{addr: "192.0.2.1:443", start: true, ms: 0},
+				{addr: "192.0.2.1:443", start: true, ms: 5},
+				{addr: "192.0.2.1:443", err: refused, ms: 10, wantElapsed: 10 * time.Millisecond, wantExtended: true},
+				{addr: "192.0.2.1:443", ms: 12, wantElapsed: 12 * time.Millisecond, wantExtended: true},
+				// A completion without a pending attempt is ignored
+				{addr: "192.0.2.1:443", ms: 15},
+			},
+			want: []ConnectAttempt{
+				{Addr: "192.0.2.1:443", Family: FamilyIPv4, Duration: 10 * time.Millisecond, Error: "connection refused"},
+				{Addr: "192.0.2.1:443", Family: FamilyIPv4, Start: 5 * time.Millisecond, Duration: 7 * time.Millisecond, Winner: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var race connectRace
+			for i, s := range tt.steps {
+				if s.start {
+					race.start(s.addr, at(s.ms))
+					continue
+				}
+				elapsed, extended := race.done(s.addr, s.err, at(s.ms))
+				if elapsed != s.wantElapsed || extended != s.wantExtended {
+					t.Errorf("step %d: done(%s) = %v, %v, want %v, %v", i, s.addr, elapsed, extended, s.wantElapsed, s.wantExtended)
+				}
+			}
+			if len(race.attempts) != len(tt.want) {
+				t.Fatalf("recorded %d attempts, want %d: %+v", len(race.attempts), len(tt.want), race.attempts)
+			}
+			for i, got := range race.attempts {
+				if got != tt.want[i] {
+					t.Errorf("attempt %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConnectAttemptsRecorded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := mustPort(t, server.URL)
+
+	// Nothing listens on the server's port at 127.0.0.2, so the first address
+	// is refused and the probe moves on to the second
+	p, err := New(Options{
+		URL:     "http://race.test:" + port + "/",
+		Timeout: 5 * time.Second,
+		Resolve: []ResolveRule{{Host: "race.test", Port: port, Addrs: []string{"127.0.0.2", "127.0.0.1"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Connects) != 2 {
+		t.Fatalf("recorded %d connection attempts, want 2: %+v", len(result.Connects), result.Connects)
+	}
+	refused, won := result.Connects[0], result.Connects[1]
+	if refused.Addr != net.JoinHostPort("127.0.0.2", port) || refused.Error == "" || refused.Winner {
+		t.Errorf("first attempt = %+v, want a failure to 127.0.0.2", refused)
+	}
+	if won.Addr != net.JoinHostPort("127.0.0.1", port) || won.Error != "" || !won.Winner {
+		t.Errorf("second attempt = %+v, want the winner at 127.0.0.1", won)
+	}
+	if won.Start < refused.Duration {
+		t.Errorf("second attempt started at %v, before the first one failed after %v", won.Start, refused.Duration)
+	}
+	if result.Timing.TCPConnection < won.Start+won.Duration {
+		t.Errorf("connect phase took %v, want it to cover both attempts (%v)", result.Timing.TCPConnection, won.Start+won.Duration)
+	}
+}
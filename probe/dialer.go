@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+)
+
+// customDialer extends net.Dialer with IPv6 preference, strict IP family
+// selection and the -connect-to and -resolve rules
+type customDialer struct {
+	*net.Dialer
+	preferIPv6 bool
+	family     string // Only connect over this family, any when empty
+	overrides  dialOverrides
+}
+
+func (d *customDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	// Restricting the network also restricts the lookup to A or AAAA records
+	network = familyNetwork(network, d.family)
+
+	override, err := d.overrides.apply(address)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		rec := recorderFromContext(ctx)
+		rec.setDialOverride(override)
+		if override.ConnectTo != "" {
+			rec.addTraceEvent(PhaseConnect, "connect_to", map[string]interface{}{"address": address, "connect_to": override.ConnectTo},
+				"Connecting to %s instead of %s", override.ConnectTo, address)
+			address = override.ConnectTo
+		}
+		if len(override.Resolve) > 0 {
+			rec.addTraceEvent(PhaseDNS, "resolve_override", map[string]interface{}{"address": address, "resolve": override.Resolve},
+				"Resolved %s to %s without a lookup", address, strings.Join(override.Resolve, ", "))
+			return d.dialAny(ctx, network, override.Resolve)
+		}
+	}
+
+	if d.family != "" || (d.preferIPv6 && network == "tcp") {
+		return d.dialFamily(ctx, network, address)
+	}
+
+	// Fallback to original dialer
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+// dialFamily resolves the host of address once, keeping the addresses of
+// the dialer's family or putting IPv6 ones first when they are preferred,
+// and dials them in order. The lookup is the hop's DNS phase, so the
+// connect phase only covers connection attempts, as in the default mode.
+func (d *customDialer) dialFamily(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return d.Dialer.DialContext(ctx, network, address)
+	}
+
+	ips, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.preferIPv6 {
+		sort.SliceStable(ips, func(i, j int) bool { return ips[i].To4() == nil && ips[j].To4() != nil })
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return d.dialAny(ctx, network, addrs)
+}
+
+// lookup resolves host to the addresses of the dialer's family, or of both
+// families when it has none. Like the Go dialer, it hides connections to
+// DNS servers from the hop's connect hooks: the resolver gets a context
+// holding only the run's recorder, and the DNS hooks are called here.
+func (d *customDialer) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	network := "ip"
+	switch d.family {
+	case FamilyIPv4:
+		network = "ip4"
+	case FamilyIPv6:
+		network = "ip6"
+	}
+	resolver := d.Dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	lookupCtx, cancel := context.WithCancel(context.WithValue(context.Background(), traceRecorderContextKey{}, recorderFromContext(ctx)))
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		lookupCtx, cancel = context.WithDeadline(lookupCtx, deadline)
+		defer cancel()
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	ips, err := resolver.LookupIP(lookupCtx, network, host)
+	if trace != nil && trace.DNSDone != nil {
+		done := httptrace.DNSDoneInfo{Err: err}
+		for _, ip := range ips {
+			done.Addrs = append(done.Addrs, net.IPAddr{IP: ip})
+		}
+		trace.DNSDone(done)
+	}
+	return ips, err
+}
+
+// dialAny dials addrs in order and returns the first connection made
+func (d *customDialer) dialAny(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.Dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all resolved addresses failed, last error: %w", lastErr)
+}
@@ -0,0 +1,88 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countEvents returns how many of the result's trace events are named event
+func countEvents(r *Result, event string) int {
+	n := 0
+	for _, e := range r.TraceEvents {
+		if e.Event == event {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFamilyLookupInDNSPhase(t *testing.T) {
+	// DNS over TCP, so a connection to the DNS server that leaked into the
+	// connect hooks would show up as a connection attempt
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveDNSStream(ln)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := mustPort(t, server.URL)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		queries []string
+	}{
+		{"ipv4 only", Options{IPFamily: FamilyIPv4}, []string{"A"}},
+		// The test server has no IPv6 addresses, so IPv6 first falls back to IPv4
+		{"prefer ipv6", Options{PreferIPv6: true}, []string{"A", "AAAA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.URL = "http://family.test:" + port + "/"
+			opts.Timeout = 5 * time.Second
+			opts.DNSServers = []string{"tcp://" + ln.Addr().String()}
+			result, err := Run(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := countEvents(result, "dns_start"); n != 1 {
+				t.Errorf("%d DNS lookups, want 1", n)
+			}
+			types := make(map[string]int)
+			for _, q := range result.DNS.Queries {
+				types[q.Type]++
+			}
+			for _, qtype := range tt.queries {
+				if types[qtype] != 1 {
+					t.Errorf("%d %s queries, want 1", types[qtype], qtype)
+				}
+			}
+			if len(result.DNS.Queries) != len(tt.queries) {
+				t.Errorf("%d DNS queries, want %d", len(result.DNS.Queries), len(tt.queries))
+			}
+			if result.Timing.DNSLookup <= 0 {
+				t.Errorf("DNS lookup took %v, want it timed in the DNS phase", result.Timing.DNSLookup)
+			}
+
+			if len(result.Connects) != 1 {
+				t.Fatalf("%d connection attempts, want 1", len(result.Connects))
+			}
+			if want := net.JoinHostPort("127.0.0.1", port); result.Connects[0].Addr != want {
+				t.Errorf("connected to %s, want %s", result.Connects[0].Addr, want)
+			}
+			if result.Family != FamilyIPv4 {
+				t.Errorf("family = %s, want %s", result.Family, FamilyIPv4)
+			}
+		})
+	}
+}
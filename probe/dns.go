@@ -0,0 +1,184 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// getSystemDNSServers reads system DNS servers from resolv.conf
+func getSystemDNSServers() []string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "nameserver") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				servers = append(servers, fields[1])
+			}
+		}
+	}
+	return servers
+}
+
+// DNS transports a custom DNS server can be reached over
+const (
+	dnsOverUDP   = "udp"
+	dnsOverTCP   = "tcp"
+	dnsOverTLS   = "tls"
+	dnsOverHTTPS = "https"
+)
+
+// dnsServer is a custom DNS server and the transport used to query it
+type dnsServer struct {
+	transport string
+	addr      string       // host:port for UDP, TCP and TLS
+	url       string       // DNS-over-HTTPS endpoint
+	client    *http.Client // DNS-over-HTTPS client, shared by all queries
+	tlsConfig *tls.Config  // DNS-over-TLS client configuration
+}
+
+// parseDNSServer parses a DNS server given as an address, which is queried
+// over UDP, or as a udp://, tcp://, tls:// or https:// URI. Addresses and
+// URI hosts may carry a port, and IPv6 addresses may be bracketed; a bare
+// IPv6 address is accepted when no port is given.
+func parseDNSServer(s string) (*dnsServer, error) {
+	if !strings.Contains(s, "://") {
+		addr, err := dnsServerAddr(s, "53")
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS server %q: %w", s, err)
+		}
+		return &dnsServer{transport: dnsOverUDP, addr: addr}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS server %q: %w", s, err)
+	}
+	server := &dnsServer{transport: strings.ToLower(u.Scheme)}
+	if server.transport != dnsOverHTTPS && (u.Path != "" || u.RawQuery != "") {
+		return nil, fmt.Errorf("invalid DNS server %q: unexpected path", s)
+	}
+	switch server.transport {
+	case dnsOverUDP, dnsOverTCP:
+		server.addr, err = dnsServerAddr(u.Host, "53")
+	case dnsOverTLS:
+		if server.addr, err = dnsServerAddr(u.Host, "853"); err == nil {
+			server.tlsConfig = &tls.Config{ServerName: u.Hostname()}
+		}
+	case dnsOverHTTPS:
+		_, err = dnsServerAddr(u.Host, "443")
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		server.url = u.String()
+		server.client = newDoHClient()
+	default:
+		return nil, fmt.Errorf("invalid DNS server %q: unsupported scheme %q, expected udp, tcp, tls or https", s, u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS server %q: %w", s, err)
+	}
+	return server, nil
+}
+
+// dnsServerAddr validates a DNS server host with an optional port and
+// returns it as host:port, using defaultPort when no port is given
+func dnsServerAddr(hostport, defaultPort string) (string, error) {
+	host, port := hostport, defaultPort
+	switch {
+	case strings.HasPrefix(hostport, "[") && strings.HasSuffix(hostport, "]"):
+		host = hostport[1 : len(hostport)-1]
+	case strings.Count(hostport, ":") == 1 || strings.HasPrefix(hostport, "["):
+		var err error
+		if host, port, err = net.SplitHostPort(hostport); err != nil {
+			return "", err
+		}
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+	if strings.Contains(host, ":") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", fmt.Errorf("invalid IPv6 address %q", host)
+		}
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// String returns the server as given on the command line, with defaults
+// filled in
+func (s *dnsServer) String() string {
+	if s.transport == dnsOverHTTPS {
+		return s.url
+	}
+	return s.transport + "://" + s.addr
+}
+
+// dial opens a connection to the server. The Go resolver frames messages by
+// the type of connection: UDP gets one message per packet, while the stream
+// connections of the other transports get length-prefixed messages. A UDP
+// server is dialed over TCP when the resolver asks for it, which it does to
+// retry truncated answers.
+func (s *dnsServer) dial(ctx context.Context, network string) (net.Conn, error) {
+	var d net.Dialer
+	switch s.transport {
+	case dnsOverTCP:
+		return d.DialContext(ctx, "tcp", s.addr)
+	case dnsOverTLS:
+		td := &tls.Dialer{NetDialer: &d, Config: s.tlsConfig}
+		return td.DialContext(ctx, "tcp", s.addr)
+	case dnsOverHTTPS:
+		return newDoHConn(ctx, s.client, s.url), nil
+	}
+	if strings.HasPrefix(network, "tcp") {
+		return d.DialContext(ctx, "tcp", s.addr)
+	}
+	return d.DialContext(ctx, "udp", s.addr)
+}
+
+// network returns the transport a query goes over when the resolver asks
+// for network: udp or tcp for UDP servers, the server's transport otherwise
+func (s *dnsServer) network(network string) string {
+	if s.transport == dnsOverUDP && strings.HasPrefix(network, "tcp") {
+		return dnsOverTCP
+	}
+	return s.transport
+}
+
+// createCustomResolver creates a DNS resolver querying the given servers,
+// picked by strategy
+func createCustomResolver(dnsServers []string, strategy string) (*net.Resolver, error) {
+	servers := make([]*dnsServer, 0, len(dnsServers))
+	for _, s := range dnsServers {
+		server, err := parseDNSServer(s)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	pool, err := newDNSPool(servers, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return &net.Resolver{PreferGo: true, Dial: pool.DialContext}, nil
+}
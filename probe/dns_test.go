@@ -0,0 +1,401 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		input     string
+		transport string
+		addr      string
+		url       string
+		wantErr   string
+	}{
+		{input: "8.8.8.8", transport: dnsOverUDP, addr: "8.8.8.8:53"},
+		{input: "8.8.8.8:5353", transport: dnsOverUDP, addr: "8.8.8.8:5353"},
+		{input: "2001:db8::1", transport: dnsOverUDP, addr: "[2001:db8::1]:53"},
+		{input: "[2001:db8::1]", transport: dnsOverUDP, addr: "[2001:db8::1]:53"},
+		{input: "[2001:db8::1]:5353", transport: dnsOverUDP, addr: "[2001:db8::1]:5353"},
+		{input: "udp://1.1.1.1", transport: dnsOverUDP, addr: "1.1.1.1:53"},
+		{input: "tcp://1.1.1.1:5353", transport: dnsOverTCP, addr: "1.1.1.1:5353"},
+		{input: "TCP://[::1]", transport: dnsOverTCP, addr: "[::1]:53"},
+		{input: "tls://dns.example.com", transport: dnsOverTLS, addr: "dns.example.com:853"},
+		{input: "tls://[2001:db8::1]:8853", transport: dnsOverTLS, addr: "[2001:db8::1]:8853"},
+		{input: "https://dns.example.com", transport: dnsOverHTTPS, url: "https://dns.example.com/dns-query"},
+		{input: "https://dns.example.com:8443/resolve", transport: dnsOverHTTPS, url: "https://dns.example.com:8443/resolve"},
+		{input: "ftp://1.1.1.1", wantErr: "unsupported scheme"},
+		{input: "tls://dns.example.com/dns-query", wantErr: "unexpected path"},
+		{input: "udp://1.1.1.1?edns=1", wantErr: "unexpected path"},
+		{input: "1.1.1.1:0", wantErr: "invalid port"},
+		{input: "1.1.1.1:65536", wantErr: "invalid port"},
+		{input: "1.1.1.1:dns", wantErr: "invalid port"},
+		{input: "2001:db8::zz", wantErr: "invalid IPv6 address"},
+		{input: "[2001:db8::1", wantErr: "invalid DNS server"},
+		{input: "", wantErr: "missing host"},
+		{input: "tcp://:53", wantErr: "missing host"},
+		{input: "https://:443", wantErr: "missing host"},
+	}
+
+	for _, tt := range tests {
+		server, err := parseDNSServer(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseDNSServer(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDNSServer(%q) error = %v", tt.input, err)
+			continue
+		}
+		if server.transport != tt.transport || server.addr != tt.addr || server.url != tt.url {
+			t.Errorf("parseDNSServer(%q) = %s %q %q, want %s %q %q",
+				tt.input, server.transport, server.addr, server.url, tt.transport, tt.addr, tt.url)
+		}
+	}
+}
+
+func TestDNSServerAddr(t *testing.T) {
+	tests := []struct {
+		hostport    string
+		defaultPort string
+		want        string
+		wantErr     bool
+	}{
+		{"9.9.9.9", "53", "9.9.9.9:53", false},
+		{"9.9.9.9", "853", "9.9.9.9:853", false},
+		{"9.9.9.9:1", "53", "9.9.9.9:1", false},
+		{"9.9.9.9:65535", "53", "9.9.9.9:65535", false},
+		{"dns.example.com:853", "53", "dns.example.com:853", false},
+		{"::1", "53", "[::1]:53", false},
+		{"[::1]", "853", "[::1]:853", false},
+		{"[::1]:8853", "853", "[::1]:8853", false},
+		{"[fe80::1%eth0]:53", "53", "[fe80::1%eth0]:53", false},
+		{":53", "53", "", true},
+		{"[]", "53", "", true},
+		{"9.9.9.9:", "53", "", true},
+		{"9.9.9.9:-1", "53", "", true},
+		{"::1::2", "53", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := dnsServerAddr(tt.hostport, tt.defaultPort)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("dnsServerAddr(%q, %q) = %q, %v, want %q, error %v", tt.hostport, tt.defaultPort, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// testDNSAnswer answers A queries for any name with 127.0.0.1 and every
+// other query with no records
+func testDNSAnswer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// Skip the question's name, then its type and class
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+
+	answer := append([]byte(nil), query[:end]...)
+	binary.BigEndian.PutUint16(answer[2:], 0x8180) // Response, recursion desired and available
+	binary.BigEndian.PutUint16(answer[6:], 0)      // Answer count
+	binary.BigEndian.PutUint16(answer[8:], 0)      // Authority count
+	binary.BigEndian.PutUint16(answer[10:], 0)     // Additional count
+	if qtype == 1 {
+		binary.BigEndian.PutUint16(answer[6:], 1)
+		answer = append(answer,
+			0xc0, 0x0c, // Pointer to the question's name
+			0x00, 0x01, // A
+			0x00, 0x01, // IN
+			0x00, 0x00, 0x00, 0x3c, // TTL
+			0x00, 0x04, 127, 0, 0, 1)
+	}
+	return answer
+}
+
+// serveDNSUDP answers queries over UDP until the connection is closed
+func serveDNSUDP(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		pc.WriteTo(testDNSAnswer(buf[:n]), addr)
+	}
+}
+
+// serveDNSStream answers length-prefixed queries from every connection
+// accepted until the listener is closed
+func serveDNSStream(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				answer := testDNSAnswer(query)
+				binary.Write(conn, binary.BigEndian, uint16(len(answer)))
+				conn.Write(answer)
+			}
+		}()
+	}
+}
+
+// newDoHServer starts a DNS-over-HTTPS server answering POSTed queries
+func newDoHServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		w.Write(testDNSAnswer(query))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testDNSServers starts UDP, TCP, DNS-over-TLS and DNS-over-HTTPS servers
+// and returns a configured dnsServer for each, by transport
+func testDNSServers(t *testing.T) map[string]*dnsServer {
+	doh := newDoHServer(t)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go serveDNSUDP(pc)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveDNSStream(ln)
+
+	// The DNS-over-TLS server reuses the test certificate, valid for 127.0.0.1
+	tlsLn, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tlsLn.Close() })
+	go serveDNSStream(tlsLn)
+
+	servers := make(map[string]*dnsServer)
+	for transport, spec := range map[string]string{
+		dnsOverUDP:   "udp://" + pc.LocalAddr().String(),
+		dnsOverTCP:   "tcp://" + ln.Addr().String(),
+		dnsOverTLS:   "tls://" + tlsLn.Addr().String(),
+		dnsOverHTTPS: doh.URL,
+	} {
+		server, err := parseDNSServer(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[transport] = server
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(doh.Certificate())
+	servers[dnsOverTLS].tlsConfig.RootCAs = roots
+	servers[dnsOverHTTPS].client = doh.Client()
+	return servers
+}
+
+// lookupA resolves name to IPv4 addresses through a pool of servers
+func lookupA(t *testing.T, pool *dnsPool, name string) ([]net.IP, error) {
+	t.Helper()
+	resolver := &net.Resolver{PreferGo: true, Dial: pool.DialContext}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return resolver.LookupIP(ctx, "ip4", name)
+}
+
+func TestResolverTransports(t *testing.T) {
+	servers := testDNSServers(t)
+	for _, transport := range []string{dnsOverUDP, dnsOverTCP, dnsOverTLS, dnsOverHTTPS} {
+		t.Run(transport, func(t *testing.T) {
+			pool, err := newDNSPool([]*dnsServer{servers[transport]}, DNSFirstHealthy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ips, err := lookupA(t, pool, "probe.test")
+			if err != nil {
+				t.Fatalf("lookup over %s failed: %v", transport, err)
+			}
+			if len(ips) != 1 || !ips[0].Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("lookup over %s = %v, want [127.0.0.1]", transport, ips)
+			}
+			if state := pool.servers[0]; state.failures != 0 || state.latency == 0 {
+				t.Errorf("server state after answer = %d failures, %v latency, want 0 failures and a latency", state.failures, state.latency)
+			}
+		})
+	}
+}
+
+func TestResolverFallsBackWhenServerDown(t *testing.T) {
+	servers := testDNSServers(t)
+
+	// Nothing listens on a port freed by closing its listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down, err := parseDNSServer("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+
+	for _, transport := range []string{dnsOverUDP, dnsOverTLS, dnsOverHTTPS} {
+		t.Run(transport, func(t *testing.T) {
+			pool, err := newDNSPool([]*dnsServer{down, servers[transport]}, DNSFirstHealthy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ips, err := lookupA(t, pool, "fallback.test")
+			if err != nil {
+				t.Fatalf("lookup failed despite a healthy server: %v", err)
+			}
+			if len(ips) != 1 || !ips[0].Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("lookup = %v, want [127.0.0.1]", ips)
+			}
+			if failed := pool.servers[0]; failed.failures == 0 || failed.healthy(time.Now()) {
+				t.Errorf("down server has %d failures and healthy %v, want it backed off", failed.failures, failed.healthy(time.Now()))
+			}
+			if ok := pool.servers[1]; ok.failures != 0 {
+				t.Errorf("healthy server has %d failures, want 0", ok.failures)
+			}
+		})
+	}
+}
+
+// dohQuery builds a length-prefixed A query for name with the given ID
+func dohQuery(id uint16, name string) []byte {
+	msg := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, 1, 0, 1)
+	return append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+// readDoHAnswer reads one length-prefixed answer from a dohConn
+func readDoHAnswer(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		t.Fatalf("reading answer length: %v", err)
+	}
+	answer := make([]byte, length)
+	if _, err := io.ReadFull(r, answer); err != nil {
+		t.Fatalf("reading answer: %v", err)
+	}
+	return answer
+}
+
+func TestDoHConnFraming(t *testing.T) {
+	srv := newDoHServer(t)
+	conn := newDoHConn(context.Background(), srv.Client(), srv.URL+"/dns-query")
+
+	// Nothing has been asked yet
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read before a query = %v, want EOF", err)
+	}
+
+	// A query split inside its length prefix and its body is sent once whole
+	first := dohQuery(0x1234, "split.test")
+	for _, part := range [][]byte{first[:1], first[1:7], first[7:]} {
+		if n, err := conn.Write(part); err != nil || n != len(part) {
+			t.Fatalf("Write(%d bytes) = %d, %v", len(part), n, err)
+		}
+	}
+	answer := readDoHAnswer(t, conn)
+	if id := binary.BigEndian.Uint16(answer); id != 0x1234 {
+		t.Errorf("answer ID = %#x, want 0x1234", id)
+	}
+	if count := binary.BigEndian.Uint16(answer[6:]); count != 1 {
+		t.Errorf("answer count = %d, want 1", count)
+	}
+
+	// Two queries in one write get two answers, in order
+	both := append(dohQuery(1, "a.test"), dohQuery(2, "b.test")...)
+	if _, err := conn.Write(both); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint16{1, 2} {
+		if id := binary.BigEndian.Uint16(readDoHAnswer(t, conn)); id != want {
+			t.Errorf("answer ID = %d, want %d", id, want)
+		}
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read after the answers = %v, want EOF", err)
+	}
+}
+
+func TestDoHConnServerError(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	conn := newDoHConn(context.Background(), srv.Client(), srv.URL)
+	_, err := conn.Write(dohQuery(1, "error.test"))
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Write to a failing server = %v, want a 503 error", err)
+	}
+}
+
+func TestDoHConnDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	conn := newDoHConn(context.Background(), srv.Client(), srv.URL)
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := conn.Write(dohQuery(1, "slow.test"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Write past the deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if conn.answer.Len() != 0 {
+		t.Errorf("answer buffered after a failed exchange: %x", conn.answer.Bytes())
+	}
+}
@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+)
+
+// DNSInfo describes the DNS lookup of a hop
+type DNSInfo struct {
+	Host      string
+	Addrs     []string
+	Coalesced bool       // Answer shared with a concurrent lookup of the same host
+	Servers   []string   // Custom DNS servers that answered, in order
+	Error     string     // Lookup error, empty on success
+	Queries   []DNSQuery // Queries sent by the custom resolver, empty for the system resolver
+}
+
+// DNSQuery is a single query sent by the custom resolver
+type DNSQuery struct {
+	Type     string // A, AAAA or the numeric query type
+	Server   string
+	Network  string        // Transport the query went over: udp, tcp, tls or https
+	Duration time.Duration // From dialing the server to its answer
+	Error    string
+}
+
+// dnsQueryTypes names the query types the resolver sends
+var dnsQueryTypes = map[uint16]string{1: "A", 5: "CNAME", 28: "AAAA"}
+
+// dnsQueryType returns the type of the first question of a DNS message, or
+// an empty string if msg is not a well formed query
+func dnsQueryType(msg []byte) string {
+	const headerLen = 12
+	if len(msg) < headerLen {
+		return ""
+	}
+	// Skip the question name, a sequence of labels ending with an empty one
+	i := headerLen
+	for i < len(msg) && msg[i] != 0 {
+		i += 1 + int(msg[i])
+	}
+	if i+3 > len(msg) {
+		return ""
+	}
+	qtype := binary.BigEndian.Uint16(msg[i+1:])
+	if name, ok := dnsQueryTypes[qtype]; ok {
+		return name
+	}
+	return strconv.Itoa(int(qtype))
+}
+
+// DNSQueryJSON represents a DNS query in JSON format
+type DNSQueryJSON struct {
+	Type     string `json:"type"`
+	Server   string `json:"server"`
+	Network  string `json:"network"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DNSJSON represents the DNS lookup of a hop in JSON format
+type DNSJSON struct {
+	Host      string         `json:"host"`
+	Addrs     []string       `json:"addrs"`
+	Coalesced bool           `json:"coalesced"`
+	Servers   []string       `json:"servers,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Queries   []DNSQueryJSON `json:"queries,omitempty"`
+}
+
+// JSON converts the DNS lookup into its JSON representation
+func (d *DNSInfo) JSON() *DNSJSON {
+	if d == nil {
+		return nil
+	}
+	result := &DNSJSON{
+		Host:      d.Host,
+		Addrs:     append([]string{}, d.Addrs...),
+		Coalesced: d.Coalesced,
+		Servers:   d.Servers,
+		Error:     d.Error,
+	}
+	for _, q := range d.Queries {
+		result.Queries = append(result.Queries, DNSQueryJSON{
+			Type:     q.Type,
+			Server:   q.Server,
+			Network:  q.Network,
+			Duration: FormatDuration(q.Duration),
+			Error:    q.Error,
+		})
+	}
+	return result
+}
@@ -0,0 +1,246 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DNS server selection strategies
+const (
+	DNSRoundRobin   = "round-robin"   // Rotate through the servers
+	DNSFirstHealthy = "first-healthy" // Use servers in the order given
+	DNSFastest      = "fastest"       // Prefer the server answering fastest
+)
+
+// Backoff applied to a server after consecutive failures, doubling from
+// dnsBackoffMin up to dnsBackoffMax
+const (
+	dnsBackoffMin = time.Second
+	dnsBackoffMax = 30 * time.Second
+)
+
+// dnsLatencyWeight is the weight of the latest answer time in a server's
+// moving average
+const dnsLatencyWeight = 0.3
+
+// dnsServerState tracks the health of a server in a pool
+type dnsServerState struct {
+	server   *dnsServer
+	failures int           // Consecutive failures
+	retryAt  time.Time     // Server is skipped until then, unless all are
+	latency  time.Duration // Moving average of the time to answer, zero until measured
+}
+
+// healthy reports whether the server is out of backoff at now
+func (s *dnsServerState) healthy(now time.Time) bool {
+	return !now.Before(s.retryAt)
+}
+
+// dnsPool picks the server each resolver connection goes to, and tracks
+// the failures and answer times of every server. It is shared by all runs
+// and workers of a probe, so its state is guarded by mu.
+type dnsPool struct {
+	strategy string
+	now      func() time.Time // Clock backoff is measured against
+
+	mu      sync.Mutex
+	servers []*dnsServerState
+	next    int // Next server in round-robin order
+}
+
+// newDNSPool creates a pool of servers picked by strategy, round-robin when
+// strategy is empty
+func newDNSPool(servers []*dnsServer, strategy string) (*dnsPool, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers given")
+	}
+	switch strategy {
+	case "":
+		strategy = DNSRoundRobin
+	case DNSRoundRobin, DNSFirstHealthy, DNSFastest:
+	default:
+		return nil, fmt.Errorf("invalid DNS strategy %q, expected %s, %s or %s", strategy, DNSRoundRobin, DNSFirstHealthy, DNSFastest)
+	}
+	pool := &dnsPool{strategy: strategy, now: time.Now}
+	for _, server := range servers {
+		pool.servers = append(pool.servers, &dnsServerState{server: server})
+	}
+	return pool, nil
+}
+
+// candidates returns the servers in the order they should be tried: the
+// healthy ones ordered by the strategy, then those in backoff, soonest out
+// of it first
+func (p *dnsPool) candidates() []*dnsServerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ordered := make([]*dnsServerState, 0, len(p.servers))
+	if p.strategy == DNSRoundRobin {
+		ordered = append(ordered, p.servers[p.next:]...)
+		ordered = append(ordered, p.servers[:p.next]...)
+		p.next = (p.next + 1) % len(p.servers)
+	} else {
+		ordered = append(ordered, p.servers...)
+	}
+
+	now := p.now()
+	var healthy, backoff []*dnsServerState
+	for _, s := range ordered {
+		if s.healthy(now) {
+			healthy = append(healthy, s)
+		} else {
+			backoff = append(backoff, s)
+		}
+	}
+	if p.strategy == DNSFastest {
+		// Unmeasured servers sort first, so every server gets measured
+		sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].latency < healthy[j].latency })
+	}
+	sort.SliceStable(backoff, func(i, j int) bool { return backoff[i].retryAt.Before(backoff[j].retryAt) })
+	return append(healthy, backoff...)
+}
+
+// success records an answer from a server after elapsed
+func (p *dnsPool) success(s *dnsServerState, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s.failures = 0
+	s.retryAt = time.Time{}
+	if s.latency == 0 {
+		s.latency = elapsed
+	} else {
+		s.latency += time.Duration(dnsLatencyWeight * float64(elapsed-s.latency))
+	}
+}
+
+// failure records a failed connection or query and backs the server off
+func (p *dnsPool) failure(s *dnsServerState) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s.failures++
+	backoff := dnsBackoffMax
+	if s.failures <= 5 {
+		backoff = min(dnsBackoffMin<<(s.failures-1), dnsBackoffMax)
+	}
+	s.retryAt = p.now().Add(backoff)
+	return backoff
+}
+
+// DialContext is the resolver's Dial function. It ignores the address of
+// the system server the resolver asks for, dials the pool's servers in
+// candidate order over the requested network and returns the first
+// connection established.
+func (p *dnsPool) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	rec := recorderFromContext(ctx)
+	var lastErr error
+	for _, s := range p.candidates() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rec.addTraceEvent(PhaseDNS, "dns_server",
+			map[string]interface{}{"server": s.server.String(), "transport": s.server.transport, "network": network, "strategy": p.strategy},
+			"Attempting DNS resolution using server: %s", s.server)
+
+		start := time.Now()
+		conn, err := s.server.dial(ctx, network)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() == nil {
+				backoff := p.failure(s)
+				rec.addTraceEvent(PhaseDNS, "dns_server_failed",
+					map[string]interface{}{"server": s.server.String(), "error": err.Error(), "backoff": backoff.String()},
+					"DNS server %s failed, backing off for %s: %v", s.server, backoff, err)
+			}
+			continue
+		}
+		return trackDNSConn(conn, p, s, s.server.network(network), start, rec), nil
+	}
+	return nil, fmt.Errorf("all DNS servers failed, last error: %v", lastErr)
+}
+
+// trackedDNSConn reports the outcome of the first read of a resolver
+// connection, which is the server's answer or the query's failure, to the
+// pool and the run's recorder
+type trackedDNSConn struct {
+	net.Conn
+	pool    *dnsPool
+	server  *dnsServerState
+	network string
+	start   time.Time
+	rec     *traceRecorder
+	stream  bool   // Messages are length-prefixed
+	qtype   string // Type of the query written
+	once    sync.Once
+}
+
+// trackedDNSPacketConn is a trackedDNSConn over UDP. The resolver only uses
+// packet framing for connections that are net.PacketConn, so it keeps
+// that interface.
+type trackedDNSPacketConn struct {
+	*trackedDNSConn
+}
+
+// trackDNSConn wraps a resolver connection so its outcome reaches the pool
+func trackDNSConn(conn net.Conn, pool *dnsPool, server *dnsServerState, network string, start time.Time, rec *traceRecorder) net.Conn {
+	c := &trackedDNSConn{Conn: conn, pool: pool, server: server, network: network, start: start, rec: rec}
+	if _, ok := conn.(net.PacketConn); ok {
+		return &trackedDNSPacketConn{c}
+	}
+	c.stream = true
+	return c
+}
+
+func (c *trackedDNSConn) Write(b []byte) (int, error) {
+	if c.qtype == "" {
+		msg := b
+		if c.stream && len(msg) >= 2 {
+			msg = msg[2:]
+		}
+		c.qtype = dnsQueryType(msg)
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *trackedDNSConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.done(err)
+	return n, err
+}
+
+func (c *trackedDNSPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.Conn.(net.PacketConn).ReadFrom(b)
+	c.done(err)
+	return n, addr, err
+}
+
+func (c *trackedDNSPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Conn.(net.PacketConn).WriteTo(b, addr)
+}
+
+// done records the first read's outcome. Reads cut short by the probe's
+// own cancellation say nothing about the server.
+func (c *trackedDNSConn) done(err error) {
+	c.once.Do(func() {
+		query := DNSQuery{Type: c.qtype, Server: c.server.server.String(), Network: c.network, Duration: time.Since(c.start)}
+		if err == nil {
+			c.pool.success(c.server, query.Duration)
+			c.rec.addDNSQuery(query)
+			return
+		}
+		if errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled) {
+			return
+		}
+		query.Error = err.Error()
+		c.rec.addDNSQuery(query)
+		backoff := c.pool.failure(c.server)
+		c.rec.addTraceEvent(PhaseDNS, "dns_server_failed",
+			map[string]interface{}{"server": c.server.server.String(), "error": err.Error(), "backoff": backoff.String()},
+			"DNS server %s failed, backing off for %s: %v", c.server.server, backoff, err)
+	})
+}
@@ -0,0 +1,155 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClock is a settable clock for a pool
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+// newTestPool creates a pool of UDP servers named by addrs on a test clock
+func newTestPool(t *testing.T, strategy string, addrs ...string) (*dnsPool, *testClock) {
+	t.Helper()
+	var servers []*dnsServer
+	for _, addr := range addrs {
+		server, err := parseDNSServer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, server)
+	}
+	pool, err := newDNSPool(servers, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	pool.now = clock.Now
+	return pool, clock
+}
+
+// candidateAddrs returns the addresses of the pool's candidates, in order
+func candidateAddrs(pool *dnsPool) string {
+	var addrs []string
+	for _, s := range pool.candidates() {
+		addrs = append(addrs, strings.TrimSuffix(s.server.addr, ":53"))
+	}
+	return strings.Join(addrs, " ")
+}
+
+func TestNewDNSPoolStrategy(t *testing.T) {
+	server := &dnsServer{transport: dnsOverUDP, addr: "192.0.2.1:53"}
+	pool, err := newDNSPool([]*dnsServer{server}, "")
+	if err != nil || pool.strategy != DNSRoundRobin {
+		t.Errorf("newDNSPool with no strategy = %v, %v, want round-robin", pool, err)
+	}
+	if _, err := newDNSPool([]*dnsServer{server}, "random"); err == nil {
+		t.Error("newDNSPool accepted an unknown strategy")
+	}
+	if _, err := newDNSPool(nil, DNSRoundRobin); err == nil {
+		t.Error("newDNSPool accepted no servers")
+	}
+}
+
+func TestDNSPoolStrategies(t *testing.T) {
+	t.Run(DNSRoundRobin, func(t *testing.T) {
+		pool, _ := newTestPool(t, DNSRoundRobin, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+		for _, want := range []string{
+			"192.0.2.1 192.0.2.2 192.0.2.3",
+			"192.0.2.2 192.0.2.3 192.0.2.1",
+			"192.0.2.3 192.0.2.1 192.0.2.2",
+			"192.0.2.1 192.0.2.2 192.0.2.3",
+		} {
+			if got := candidateAddrs(pool); got != want {
+				t.Errorf("candidates = %s, want %s", got, want)
+			}
+		}
+	})
+
+	t.Run(DNSFirstHealthy, func(t *testing.T) {
+		pool, _ := newTestPool(t, DNSFirstHealthy, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+		for i := 0; i < 3; i++ {
+			if got, want := candidateAddrs(pool), "192.0.2.1 192.0.2.2 192.0.2.3"; got != want {
+				t.Errorf("candidates = %s, want %s", got, want)
+			}
+		}
+	})
+
+	t.Run(DNSFastest, func(t *testing.T) {
+		pool, _ := newTestPool(t, DNSFastest, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+		pool.success(pool.servers[0], 30*time.Millisecond)
+		pool.success(pool.servers[1], 10*time.Millisecond)
+		// The unmeasured server comes first so it gets measured
+		if got, want := candidateAddrs(pool), "192.0.2.3 192.0.2.2 192.0.2.1"; got != want {
+			t.Errorf("candidates = %s, want %s", got, want)
+		}
+		pool.success(pool.servers[2], 20*time.Millisecond)
+		if got, want := candidateAddrs(pool), "192.0.2.2 192.0.2.3 192.0.2.1"; got != want {
+			t.Errorf("candidates = %s, want %s", got, want)
+		}
+		// A slow answer moves the average a third of the way, not all of it
+		pool.success(pool.servers[1], 40*time.Millisecond)
+		if got := pool.servers[1].latency; got != 19*time.Millisecond {
+			t.Errorf("latency after a slow answer = %v, want 19ms", got)
+		}
+		if got, want := candidateAddrs(pool), "192.0.2.2 192.0.2.3 192.0.2.1"; got != want {
+			t.Errorf("candidates = %s, want %s", got, want)
+		}
+	})
+}
+
+func TestDNSPoolBackoff(t *testing.T) {
+	pool, clock := newTestPool(t, DNSFirstHealthy, "192.0.2.1", "192.0.2.2")
+	failed := pool.servers[0]
+
+	if backoff := pool.failure(failed); backoff != dnsBackoffMin {
+		t.Errorf("first backoff = %v, want %v", backoff, dnsBackoffMin)
+	}
+	// Backed off servers are only tried after the healthy ones
+	if got, want := candidateAddrs(pool), "192.0.2.2 192.0.2.1"; got != want {
+		t.Errorf("candidates in backoff = %s, want %s", got, want)
+	}
+	clock.now = clock.now.Add(dnsBackoffMin - time.Millisecond)
+	if got, want := candidateAddrs(pool), "192.0.2.2 192.0.2.1"; got != want {
+		t.Errorf("candidates just before the backoff expires = %s, want %s", got, want)
+	}
+
+	// Once the backoff expires the server is retried in its usual place
+	clock.now = clock.now.Add(time.Millisecond)
+	if got, want := candidateAddrs(pool), "192.0.2.1 192.0.2.2"; got != want {
+		t.Errorf("candidates after the backoff = %s, want %s", got, want)
+	}
+
+	// Consecutive failures double the backoff up to the maximum
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, dnsBackoffMax, dnsBackoffMax} {
+		if backoff := pool.failure(failed); backoff != want {
+			t.Errorf("backoff after %d failures = %v, want %v", failed.failures, backoff, want)
+		}
+	}
+
+	// A success clears the failures
+	pool.success(failed, 5*time.Millisecond)
+	if failed.failures != 0 || !failed.healthy(clock.now) {
+		t.Errorf("after a success: %d failures, healthy %v, want 0 and true", failed.failures, failed.healthy(clock.now))
+	}
+	if backoff := pool.failure(failed); backoff != dnsBackoffMin {
+		t.Errorf("backoff after a success and a failure = %v, want %v", backoff, dnsBackoffMin)
+	}
+}
+
+func TestDNSPoolAllBackedOff(t *testing.T) {
+	pool, clock := newTestPool(t, DNSRoundRobin, "192.0.2.1", "192.0.2.2")
+	pool.failure(pool.servers[1])
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	pool.failure(pool.servers[0])
+
+	// With every server backed off, the one out of backoff soonest goes first
+	if got, want := candidateAddrs(pool), "192.0.2.2 192.0.2.1"; got != want {
+		t.Errorf("candidates = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dohContentType is the media type of DNS messages sent over HTTPS
+const dohContentType = "application/dns-message"
+
+// maxDoHResponse bounds the size of a DNS-over-HTTPS response body
+const maxDoHResponse = 64 << 10
+
+// newDoHClient creates the HTTP client a DNS-over-HTTPS server is queried
+// with. It keeps its own connections, resolved by the system resolver, so
+// queries neither recurse into the custom resolver nor count towards the
+// probed connections.
+func newDoHClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			ForceAttemptHTTP2:   true,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// dohConn adapts DNS-over-HTTPS to the stream connection the Go resolver
+// expects. Each length-prefixed query written is POSTed to the server, and
+// the answer is buffered, length-prefixed, for the following reads.
+type dohConn struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+
+	mu       sync.Mutex
+	deadline time.Time
+	query    bytes.Buffer
+	answer   bytes.Buffer
+}
+
+// newDoHConn creates a connection whose queries are sent to url
+func newDoHConn(ctx context.Context, client *http.Client, url string) *dohConn {
+	return &dohConn{ctx: ctx, client: client, url: url}
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query.Write(b)
+	for c.query.Len() >= 2 {
+		length := int(binary.BigEndian.Uint16(c.query.Bytes()))
+		if c.query.Len() < 2+length {
+			break
+		}
+		c.query.Next(2)
+		answer, err := c.exchange(c.query.Next(length))
+		if err != nil {
+			return 0, err
+		}
+		var prefix [2]byte
+		binary.BigEndian.PutUint16(prefix[:], uint16(len(answer)))
+		c.answer.Write(prefix[:])
+		c.answer.Write(answer)
+	}
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answer.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.answer.Read(b)
+}
+
+// exchange POSTs a query to the server and returns its answer. The request
+// is detached from the probe's context, which carries the probe's
+// httptrace hooks, but still ends with it or at the connection deadline.
+func (c *dohConn) exchange(query []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !c.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS server returned %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponse))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) > 0xffff {
+		return nil, fmt.Errorf("DNS-over-HTTPS answer too large")
+	}
+	return answer, nil
+}
+
+func (c *dohConn) Close() error {
+	return nil
+}
+
+func (c *dohConn) LocalAddr() net.Addr {
+	return dohAddr("")
+}
+
+func (c *dohConn) RemoteAddr() net.Addr {
+	return dohAddr(c.url)
+}
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *dohConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+// dohAddr is the address of a DNS-over-HTTPS endpoint
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,27 @@
+package probe
+
+import "errors"
+
+// PhaseError is returned by Run and records the phase in which the probe failed
+type PhaseError struct {
+	Phase string
+	Err   error
+}
+
+func (e *PhaseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPhase returns the phase in which err occurred, or an empty string if
+// err did not come from a probe run
+func ErrorPhase(err error) string {
+	var phaseErr *PhaseError
+	if errors.As(err, &phaseErr) {
+		return phaseErr.Phase
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// IP families a probe can be restricted to
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// familyOf returns the IP family of a host:port or IP address, or an empty
+// string if it holds no IP address
+func familyOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return ""
+	}
+	if ip.Unmap().Is4() {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// familyNetwork restricts a network such as "tcp" to family
+func familyNetwork(network, family string) string {
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		return network
+	}
+	switch family {
+	case FamilyIPv4:
+		return network + "4"
+	case FamilyIPv6:
+		return network + "6"
+	}
+	return network
+}
+
+// FamilyRun is a probe made for the family comparison
+type FamilyRun struct {
+	Name   string // "default", FamilyIPv4 or FamilyIPv6
+	Result *Result
+	Err    error
+}
+
+// FamilyComparison holds probes of the same URL over IPv4, IPv6 and
+// without restriction
+type FamilyComparison struct {
+	URL  string
+	Runs []FamilyRun
+}
+
+// CompareFamilies probes the URL three times, each with its own
+// connections: as configured, over IPv4 only and over IPv6 only. The first
+// run shows which family is picked by default and whether it fell back.
+func (p *Probe) CompareFamilies(ctx context.Context) (*FamilyComparison, error) {
+	comparison := &FamilyComparison{URL: p.opts.URL}
+	for _, family := range []string{"", FamilyIPv4, FamilyIPv6} {
+		opts := p.opts
+		opts.IPFamily = family
+		if family != "" {
+			opts.PreferIPv6 = false
+		}
+		probe, err := New(opts)
+		if err != nil {
+			return nil, err
+		}
+		run := FamilyRun{Name: family}
+		if run.Name == "" {
+			run.Name = "default"
+		}
+		run.Result, run.Err = probe.Run(ctx)
+		comparison.Runs = append(comparison.Runs, run)
+	}
+	return comparison, nil
+}
+
+// firstHopFamily returns the family of the first hop's connection and
+// whether it fell back, as later hops may reuse it
+func firstHopFamily(r *Result) (string, bool) {
+	if len(r.Redirects) > 0 {
+		return r.Redirects[0].Family, r.Redirects[0].FamilyFallback
+	}
+	return r.Family, r.FamilyFallback
+}
+
+// run returns the named run
+func (c *FamilyComparison) run(name string) FamilyRun {
+	for _, r := range c.Runs {
+		if r.Name == name {
+			return r
+		}
+	}
+	return FamilyRun{Name: name}
+}
+
+// familyPhases are the phases compared between families: those of the
+// first hop, which is the one made to the requested host, and the total
+var familyPhases = []struct {
+	name  string
+	value func(*Result) time.Duration
+}{
+	{"dns", func(r *Result) time.Duration { return r.FirstHop().DNSLookup }},
+	{"connect", func(r *Result) time.Duration { return r.FirstHop().TCPConnection }},
+	{"tls", func(r *Result) time.Duration { return r.FirstHop().TLSHandshake }},
+	{"ttfb", func(r *Result) time.Duration { return r.FirstHop().ServerProcessing }},
+	{"total", (*Result).TotalTime},
+}
+
+// Deltas returns the IPv6 time minus the IPv4 time of each phase, or nil
+// unless both probes succeeded
+func (c *FamilyComparison) Deltas() map[string]time.Duration {
+	v4, v6 := c.run(FamilyIPv4).Result, c.run(FamilyIPv6).Result
+	if v4 == nil || v6 == nil {
+		return nil
+	}
+	deltas := make(map[string]time.Duration, len(familyPhases))
+	for _, phase := range familyPhases {
+		deltas[phase.name] = phase.value(v6) - phase.value(v4)
+	}
+	return deltas
+}
+
+// FamilyRunJSON represents one probe of the family comparison in JSON format
+type FamilyRunJSON struct {
+	Name       string            `json:"name"`
+	Family     string            `json:"family,omitempty"`
+	Fallback   bool              `json:"fallback"`
+	Phases     map[string]string `json:"phases,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorPhase string            `json:"error_phase,omitempty"`
+	Result     *ResponseJSON     `json:"result,omitempty"`
+}
+
+// FamilyComparisonJSON represents the family comparison in JSON format.
+// Deltas are IPv6 minus IPv4, so positive values mean IPv6 was slower.
+type FamilyComparisonJSON struct {
+	URL    string            `json:"url"`
+	Runs   []FamilyRunJSON   `json:"runs"`
+	Deltas map[string]string `json:"deltas,omitempty"`
+}
+
+// JSON converts the family comparison into its JSON representation
+func (c *FamilyComparison) JSON() FamilyComparisonJSON {
+	result := FamilyComparisonJSON{URL: c.URL, Runs: make([]FamilyRunJSON, 0, len(c.Runs))}
+	for _, run := range c.Runs {
+		r := FamilyRunJSON{Name: run.Name}
+		if run.Err != nil {
+			r.Error = run.Err.Error()
+			r.ErrorPhase = ErrorPhase(run.Err)
+		}
+		if run.Result != nil {
+			response := run.Result.JSON()
+			r.Family, r.Fallback = firstHopFamily(run.Result)
+			r.Phases = make(map[string]string, len(familyPhases))
+			for _, phase := range familyPhases {
+				r.Phases[phase.name] = FormatDuration(phase.value(run.Result))
+			}
+			r.Result = &response
+		}
+		result.Runs = append(result.Runs, r)
+	}
+	if deltas := c.Deltas(); deltas != nil {
+		result.Deltas = make(map[string]string, len(deltas))
+		for phase, d := range deltas {
+			result.Deltas[phase] = formatDelta(d)
+		}
+	}
+	return result
+}
+
+// formatDelta formats a signed duration in milliseconds
+func formatDelta(d time.Duration) string {
+	if d >= 0 {
+		return "+" + FormatDuration(d)
+	}
+	return FormatDuration(d)
+}
@@ -0,0 +1,251 @@
+package probe
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HAR is the root of an HTTP Archive 1.2 document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the entries of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// harCreatorVersion is reported as the creator version in HAR documents
+const harCreatorVersion = "dev"
+
+// HARCreator identifies the application that produced the HAR document
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response pair
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARNameValue is a header or query string parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARRequest describes the request of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes the response of an entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARContent describes the response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// HARTimings holds the phase durations of an entry in milliseconds, -1
+// meaning the phase does not apply
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harMillis converts a duration into HAR milliseconds
+func harMillis(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
+
+// harHeaders converts a header into sorted HAR name/value pairs
+func harHeaders(header http.Header) []HARNameValue {
+	pairs := make([]HARNameValue, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// harQueryString converts the query of rawURL into HAR name/value pairs
+func harQueryString(rawURL string) []HARNameValue {
+	pairs := make([]HARNameValue, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// harTimings maps a hop's Timing onto HAR timings. HAR counts the TLS
+// handshake inside connect, and reused connections have no DNS, connect or
+// SSL phase at all.
+func harTimings(t Timing, secure bool) HARTimings {
+	timings := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	if !t.ReusedConnection {
+		timings.DNS = harMillis(t.DNSLookup)
+		timings.Connect = harMillis(t.TCPConnection + t.TLSHandshake)
+		if secure {
+			timings.SSL = harMillis(t.TLSHandshake)
+		}
+	}
+
+	// ServerProcessing runs from getting the connection to the first byte
+	wait := t.ServerProcessing - t.RequestWrite
+	if !t.ReusedConnection {
+		wait -= t.DNSLookup + t.TCPConnection + t.TLSHandshake
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	timings.Send = harMillis(t.RequestWrite)
+	timings.Wait = harMillis(wait)
+	timings.Receive = harMillis(t.ContentTransfer)
+	return timings
+}
+
+// harEntryTime sums the applicable timings of an entry
+func harEntryTime(t HARTimings) float64 {
+	total := t.Send + t.Wait + t.Receive
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect} {
+		if v > 0 {
+			total += v
+		}
+	}
+	return total
+}
+
+// harStatusText strips the status code from a status line such as "200 OK"
+func harStatusText(status string) string {
+	if _, text, ok := strings.Cut(status, " "); ok {
+		return text
+	}
+	return status
+}
+
+// harEntry builds the HAR entry of one hop
+func harEntry(rawURL, proto string, statusCode int, status string, responseHeader http.Header,
+	bodySize int64, start time.Time, timing Timing, request RequestInfo, redirectURL string, trace []TraceEvent) HAREntry {
+	timings := harTimings(timing, strings.HasPrefix(rawURL, "https://"))
+
+	return HAREntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            harEntryTime(timings),
+		Request: HARRequest{
+			Method:      request.Method,
+			URL:         rawURL,
+			HTTPVersion: proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(request.Header),
+			QueryString: harQueryString(rawURL),
+			HeadersSize: request.HeaderBytes,
+			BodySize:    request.BodySize,
+		},
+		Response: HARResponse{
+			Status:      statusCode,
+			StatusText:  harStatusText(status),
+			HTTPVersion: proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(responseHeader),
+			Content: HARContent{
+				Size:     bodySize,
+				MimeType: responseHeader.Get("Content-Type"),
+			},
+			RedirectURL: redirectURL,
+			HeadersSize: -1,
+			BodySize:    bodySize,
+		},
+		Timings: timings,
+		Comment: strings.Join(FormatTrace(trace), "\n"),
+	}
+}
+
+// HAR converts the result into an HTTP Archive with one entry per hop of
+// the redirect chain. The trace of each hop is attached as its comment.
+func (r *Result) HAR() HAR {
+	entries := make([]HAREntry, 0, len(r.Redirects)+1)
+	traced := 0
+	for i, redirect := range r.Redirects {
+		next := r.URL
+		if i+1 < len(r.Redirects) {
+			next = r.Redirects[i+1].URL
+		}
+		// The body of a redirect response is discarded unread
+		bodySize := int64(-1)
+		if length := redirect.ResponseHeader.Get("Content-Length"); length != "" {
+			if n, err := strconv.ParseInt(length, 10, 64); err == nil {
+				bodySize = n
+			}
+		}
+		entries = append(entries, harEntry(redirect.URL, redirect.HTTPProtocol, redirect.StatusCode, redirect.Status,
+			redirect.ResponseHeader, bodySize, redirect.StartTime, redirect.Timing, redirect.Request, next, redirect.TraceEvents))
+		traced += len(redirect.TraceEvents)
+	}
+
+	// Events not claimed by a redirect hop belong to the final hop
+	var finalTrace []TraceEvent
+	if traced < len(r.TraceEvents) {
+		finalTrace = r.TraceEvents[traced:]
+	}
+	entries = append(entries, harEntry(r.URL, r.HTTPProtocol, r.StatusCode, r.Status,
+		r.ResponseHeader, r.BodySize, r.StartTime, r.Timing, r.Request, "", finalTrace))
+
+	return HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "httpstat", Version: harCreatorVersion},
+			Entries: entries,
+		},
+	}
+}
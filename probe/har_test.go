@@ -0,0 +1,166 @@
+package probe
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHARTimings(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		timing Timing
+		secure bool
+		want   HARTimings
+	}{
+		{
+			name:   "new http connection",
+			timing: Timing{DNSLookup: 2 * ms, TCPConnection: 3 * ms, RequestWrite: 1 * ms, ServerProcessing: 16 * ms, ContentTransfer: 4 * ms},
+			want:   HARTimings{Blocked: -1, DNS: 2, Connect: 3, SSL: -1, Send: 1, Wait: 10, Receive: 4},
+		},
+		{
+			name: "new https connection",
+			timing: Timing{DNSLookup: 2 * ms, TCPConnection: 3 * ms, TLSHandshake: 5 * ms, RequestWrite: 1 * ms,
+				ServerProcessing: 21 * ms, ContentTransfer: 4 * ms},
+			secure: true,
+			want:   HARTimings{Blocked: -1, DNS: 2, Connect: 8, SSL: 5, Send: 1, Wait: 10, Receive: 4},
+		},
+		{
+			name:   "reused connection",
+			timing: Timing{RequestWrite: 1 * ms, ServerProcessing: 11 * ms, ContentTransfer: 4 * ms, ReusedConnection: true},
+			secure: true,
+			want:   HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 1, Wait: 10, Receive: 4},
+		},
+		{
+			name:   "reused connection with stale connection phases",
+			timing: Timing{DNSLookup: 2 * ms, TCPConnection: 3 * ms, RequestWrite: 1 * ms, ServerProcessing: 11 * ms, ReusedConnection: true},
+			want:   HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 1, Wait: 10, Receive: 0},
+		},
+		{
+			name:   "wait never negative",
+			timing: Timing{DNSLookup: 2 * ms, TCPConnection: 3 * ms, RequestWrite: 1 * ms, ServerProcessing: 5 * ms},
+			want:   HARTimings{Blocked: -1, DNS: 2, Connect: 3, SSL: -1, Send: 1, Wait: 0, Receive: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		got := harTimings(tt.timing, tt.secure)
+		if got != tt.want {
+			t.Errorf("%s: harTimings = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHAREntryTimeAddsUp(t *testing.T) {
+	ms := time.Millisecond
+	for _, timing := range []Timing{
+		{DNSLookup: 2 * ms, TCPConnection: 3 * ms, TLSHandshake: 5 * ms, RequestWrite: 1 * ms, ServerProcessing: 21 * ms, ContentTransfer: 4 * ms},
+		{RequestWrite: 1 * ms, ServerProcessing: 11 * ms, ContentTransfer: 4 * ms, ReusedConnection: true},
+	} {
+		timings := harTimings(timing, true)
+		// SSL is part of connect, so it is not added again
+		want := harMillis(timing.ServerProcessing + timing.ContentTransfer)
+		if got := harEntryTime(timings); math.Abs(got-want) > 1e-9 {
+			t.Errorf("time of %+v = %v, want %v", timings, got, want)
+		}
+	}
+}
+
+func TestResultHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served", r.URL.Path)
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/middle?step=2", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/middle" {
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	result, err := Run(context.Background(), Options{
+		URL:     server.URL + "/",
+		Timeout: 5 * time.Second,
+		Header:  http.Header{"X-Probe": {"har"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	har := result.HAR()
+
+	entries := har.Log.Entries
+	if har.Log.Version != "1.2" || len(entries) != 3 {
+		t.Fatalf("HAR %s with %d entries, want 1.2 with one per redirect hop and the final response", har.Log.Version, len(entries))
+	}
+	wantURLs := []string{server.URL + "/", server.URL + "/middle?step=2", server.URL + "/final"}
+	wantRedirects := []string{server.URL + "/middle?step=2", server.URL + "/final", ""}
+	wantStatus := []int{http.StatusFound, http.StatusMovedPermanently, http.StatusOK}
+	for i, entry := range entries {
+		if entry.Request.URL != wantURLs[i] || entry.Response.RedirectURL != wantRedirects[i] || entry.Response.Status != wantStatus[i] {
+			t.Errorf("entry %d: %s -> %d %q, want %s -> %d %q", i, entry.Request.URL, entry.Response.Status,
+				entry.Response.RedirectURL, wantURLs[i], wantStatus[i], wantRedirects[i])
+		}
+		if !hasHARHeader(entry.Request.Headers, "X-Probe", "har") {
+			t.Errorf("entry %d: request headers %v lack X-Probe", i, entry.Request.Headers)
+		}
+		path := strings.TrimPrefix(strings.SplitN(wantURLs[i], "?", 2)[0], server.URL)
+		if !hasHARHeader(entry.Response.Headers, "X-Served", path) {
+			t.Errorf("entry %d: response headers %v lack X-Served: %s", i, entry.Response.Headers, path)
+		}
+		if entry.Comment == "" {
+			t.Errorf("entry %d has no trace comment", i)
+		}
+		if math.Abs(entry.Time-harEntryTime(entry.Timings)) > 1e-9 {
+			t.Errorf("entry %d: time %v, want the sum of its timings %v", i, entry.Time, harEntryTime(entry.Timings))
+		}
+		if entry.Timings.SSL != -1 {
+			t.Errorf("entry %d: ssl = %v, want -1 over http", i, entry.Timings.SSL)
+		}
+	}
+
+	// The first hop connects, the others reuse its connection
+	if entries[0].Timings.Connect < 0 {
+		t.Errorf("first hop connect = %v, want it measured", entries[0].Timings.Connect)
+	}
+	for _, entry := range entries[1:] {
+		if entry.Timings.DNS != -1 || entry.Timings.Connect != -1 {
+			t.Errorf("reused hop %s: dns %v, connect %v, want -1", entry.Request.URL, entry.Timings.DNS, entry.Timings.Connect)
+		}
+	}
+	if q := entries[1].Request.QueryString; len(q) != 1 || q[0] != (HARNameValue{Name: "step", Value: "2"}) {
+		t.Errorf("query string = %v, want step=2", q)
+	}
+
+	// Each hop's comment holds its own trace events
+	if want := strings.Join(FormatTrace(result.Redirects[0].TraceEvents), "\n"); entries[0].Comment != want {
+		t.Errorf("first hop comment = %q, want %q", entries[0].Comment, want)
+	}
+	if !strings.Contains(entries[0].Comment, "Connected to") {
+		t.Errorf("first hop comment %q lacks the connection events", entries[0].Comment)
+	}
+	if strings.Contains(entries[1].Comment, "Connected to") {
+		t.Errorf("reused hop comment %q holds the first hop's connection events", entries[1].Comment)
+	}
+	if last := entries[2]; last.Response.Content.Size != 4 || last.Response.Content.MimeType != "text/plain" {
+		t.Errorf("final content = %+v, want 4 bytes of text/plain", last.Response.Content)
+	}
+}
+
+// hasHARHeader reports whether headers hold name with value
+func hasHARHeader(headers []HARNameValue, name, value string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) && h.Value == value {
+			return true
+		}
+	}
+	return false
+}
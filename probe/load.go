@@ -0,0 +1,226 @@
+package probe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LoadOptions controls a concurrent load run. The run stops after Count
+// requests or once Duration has elapsed, whichever comes first; a zero value
+// disables that limit, but at least one of them must be set.
+type LoadOptions struct {
+	Concurrency int           // Number of workers issuing requests
+	Rate        float64       // Requests started per second, zero for no limit
+	Count       int           // Total number of requests
+	Duration    time.Duration // Total run time
+}
+
+// histogramBounds are the upper bounds of the latency histogram buckets
+var histogramBounds = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// HistogramBucket counts samples up to UpperBound. The last bucket of a
+// histogram has a zero UpperBound and holds every larger sample.
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      int
+}
+
+// Histogram is a latency distribution over fixed buckets
+type Histogram []HistogramBucket
+
+// newHistogram buckets the given samples
+func newHistogram(samples []time.Duration) Histogram {
+	histogram := make(Histogram, len(histogramBounds)+1)
+	for i, bound := range histogramBounds {
+		histogram[i].UpperBound = bound
+	}
+	for _, d := range samples {
+		i := 0
+		for i < len(histogramBounds) && d > histogramBounds[i] {
+			i++
+		}
+		histogram[i].Count++
+	}
+	return histogram
+}
+
+// LoadResult holds the outcome of a load run
+type LoadResult struct {
+	URL           string
+	Concurrency   int
+	Requests      int
+	Errors        int
+	ErrorsByPhase map[string]int
+	Elapsed       time.Duration
+	Stats         Stats
+	Histograms    map[string]Histogram
+}
+
+// Throughput returns the completed requests per second
+func (r *LoadResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Load drives the probe from a pool of workers sharing one transport and
+// records the timing of every request
+func (p *Probe) Load(ctx context.Context, lo LoadOptions) *LoadResult {
+	if lo.Concurrency < 1 {
+		lo.Concurrency = 1
+	}
+	if lo.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lo.Duration)
+		defer cancel()
+	}
+
+	// The dispatcher hands out one job per request, paced by the rate limit
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		if lo.Rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / lo.Rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i := 0; lo.Count <= 0 || i < lo.Count; i++ {
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tick:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- struct{}{}:
+			}
+		}
+	}()
+
+	load := &LoadResult{
+		URL:           p.opts.URL,
+		Concurrency:   lo.Concurrency,
+		ErrorsByPhase: make(map[string]int),
+	}
+	var timings []Timing
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for w := 0; w < lo.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				// Requests in flight when the run ends are allowed to finish
+				result, err := p.Run(context.WithoutCancel(ctx))
+
+				mu.Lock()
+				load.Requests++
+				if err != nil {
+					load.Errors++
+					load.ErrorsByPhase[ErrorPhase(err)]++
+				} else {
+					timings = append(timings, result.Timing)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	load.Elapsed = time.Since(start)
+
+	load.Stats = ComputeStats(timings)
+	load.Histograms = phaseHistograms(timings)
+	return load
+}
+
+// phaseHistograms buckets each phase of the given timings. As in
+// ComputeStats, connection phases only count new connections.
+func phaseHistograms(timings []Timing) map[string]Histogram {
+	var dns, tcp, tlsHandshake, ttfb, ttlb []time.Duration
+	for _, t := range timings {
+		if !t.ReusedConnection {
+			dns = append(dns, t.DNSLookup)
+			tcp = append(tcp, t.TCPConnection)
+			tlsHandshake = append(tlsHandshake, t.TLSHandshake)
+		}
+		ttfb = append(ttfb, t.ServerProcessing)
+		ttlb = append(ttlb, t.ContentTransfer)
+	}
+	return map[string]Histogram{
+		"dns_lookup":     newHistogram(dns),
+		"tcp_connection": newHistogram(tcp),
+		"tls_handshake":  newHistogram(tlsHandshake),
+		"ttfb":           newHistogram(ttfb),
+		"ttlb":           newHistogram(ttlb),
+	}
+}
+
+// HistogramBucketJSON represents a histogram bucket in JSON format
+type HistogramBucketJSON struct {
+	LE    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// LoadJSON represents a load run in JSON format
+type LoadJSON struct {
+	URL           string                           `json:"url"`
+	Concurrency   int                              `json:"concurrency"`
+	Requests      int                              `json:"requests"`
+	Errors        int                              `json:"errors"`
+	ErrorsByPhase map[string]int                   `json:"errors_by_phase,omitempty"`
+	Elapsed       string                           `json:"elapsed"`
+	Throughput    float64                          `json:"throughput_rps"`
+	Stats         StatsJSON                        `json:"stats"`
+	Histograms    map[string][]HistogramBucketJSON `json:"histograms"`
+}
+
+// JSON converts the load run into its JSON representation
+func (r *LoadResult) JSON() LoadJSON {
+	result := LoadJSON{
+		URL:         r.URL,
+		Concurrency: r.Concurrency,
+		Requests:    r.Requests,
+		Errors:      r.Errors,
+		Elapsed:     FormatDuration(r.Elapsed),
+		Throughput:  r.Throughput(),
+		Stats:       r.Stats.JSON(),
+		Histograms:  make(map[string][]HistogramBucketJSON, len(r.Histograms)),
+	}
+	if len(r.ErrorsByPhase) > 0 {
+		result.ErrorsByPhase = r.ErrorsByPhase
+	}
+
+	for phase, histogram := range r.Histograms {
+		buckets := make([]HistogramBucketJSON, 0, len(histogram))
+		for _, bucket := range histogram {
+			le := "+Inf"
+			if bucket.UpperBound > 0 {
+				le = FormatDuration(bucket.UpperBound)
+			}
+			buckets = append(buckets, HistogramBucketJSON{LE: le, Count: bucket.Count})
+		}
+		result.Histograms[phase] = buckets
+	}
+	return result
+}
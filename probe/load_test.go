@@ -0,0 +1,156 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHistogramBucketEdges(t *testing.T) {
+	histogram := newHistogram([]time.Duration{
+		0,
+		1 * time.Millisecond,            // On the first bound
+		1*time.Millisecond + 1,          // Just above it
+		5 * time.Millisecond,            // On an inner bound
+		5 * time.Second,                 // On the last bound
+		5*time.Second + time.Nanosecond, // Overflow
+		time.Minute,                     // Overflow
+	})
+
+	if len(histogram) != len(histogramBounds)+1 {
+		t.Fatalf("len(histogram) = %d, want %d", len(histogram), len(histogramBounds)+1)
+	}
+	want := map[time.Duration]int{
+		1 * time.Millisecond: 2,
+		2 * time.Millisecond: 1,
+		5 * time.Millisecond: 1,
+		5 * time.Second:      1,
+		0:                    2, // The overflow bucket
+	}
+	for _, bucket := range histogram {
+		if bucket.Count != want[bucket.UpperBound] {
+			t.Errorf("bucket le %v has %d samples, want %d", bucket.UpperBound, bucket.Count, want[bucket.UpperBound])
+		}
+	}
+	if last := histogram[len(histogram)-1]; last.UpperBound != 0 {
+		t.Errorf("last bucket bound = %v, want 0 for +Inf", last.UpperBound)
+	}
+}
+
+func TestLoadCountsRequests(t *testing.T) {
+	var served atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	p, err := New(Options{URL: srv.URL, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := p.Load(context.Background(), LoadOptions{Concurrency: 4, Count: 20})
+
+	if load.Requests != 20 || load.Errors != 0 {
+		t.Errorf("requests = %d, errors = %d, want 20 and 0", load.Requests, load.Errors)
+	}
+	if got := served.Load(); got != 20 {
+		t.Errorf("server saw %d requests, want 20", got)
+	}
+	if load.Stats.Samples != 20 {
+		t.Errorf("Stats.Samples = %d, want 20", load.Stats.Samples)
+	}
+	var ttfb int
+	for _, bucket := range load.Histograms["ttfb"] {
+		ttfb += bucket.Count
+	}
+	if ttfb != 20 {
+		t.Errorf("ttfb histogram holds %d samples, want 20", ttfb)
+	}
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	p, err := New(Options{URL: srv.URL, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each of the 5 requests waits for a tick of the 50/s limiter
+	load := p.Load(context.Background(), LoadOptions{Concurrency: 5, Rate: 50, Count: 5})
+
+	if load.Requests != 5 {
+		t.Fatalf("requests = %d, want 5", load.Requests)
+	}
+	if min := 5 * 20 * time.Millisecond; load.Elapsed < min {
+		t.Errorf("elapsed = %v, want at least %v at 50 requests per second", load.Elapsed, min)
+	}
+}
+
+func TestLoadCountsErrorsByPhase(t *testing.T) {
+	// Nothing listens on a port freed by closing its listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p, err := New(Options{URL: "http://" + addr + "/", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := p.Load(context.Background(), LoadOptions{Concurrency: 2, Count: 6})
+
+	if load.Requests != 6 || load.Errors != 6 {
+		t.Errorf("requests = %d, errors = %d, want 6 and 6", load.Requests, load.Errors)
+	}
+	if got := load.ErrorsByPhase[PhaseConnect]; got != 6 {
+		t.Errorf("errors by phase = %v, want 6 in %s", load.ErrorsByPhase, PhaseConnect)
+	}
+	if load.Stats.Samples != 0 {
+		t.Errorf("Stats.Samples = %d, want 0 for failed requests", load.Stats.Samples)
+	}
+}
+
+func TestLoadWriteTextHistograms(t *testing.T) {
+	load := &LoadResult{
+		URL:      "http://example.com/",
+		Requests: 12,
+		Histograms: map[string]Histogram{
+			"ttfb": newHistogram([]time.Duration{
+				3 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond,
+				15 * time.Millisecond, 6 * time.Second,
+			}),
+			"dns_lookup": newHistogram(nil),
+		},
+	}
+	var out strings.Builder
+	if err := load.WriteText(&out, false); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+
+	// Buckets run from the first to the last non-empty one, scaled to the largest
+	want := strings.Join([]string{
+		"TTFB",
+		"    <= 5ms |" + strings.Repeat("w", 40) + "| 4",
+		"   <= 10ms |" + strings.Repeat(" ", 40) + "| 0",
+		"   <= 20ms |" + strings.Repeat("w", 10) + strings.Repeat(" ", 30) + "| 1",
+	}, "\n")
+	if !strings.Contains(text, want) {
+		t.Errorf("text output lacks the TTFB histogram:\n%s\nwant:\n%s", text, want)
+	}
+	if !strings.Contains(text, "      > 5s |"+strings.Repeat("w", 10)+strings.Repeat(" ", 30)+"| 1\n") {
+		t.Errorf("text output lacks the overflow bucket:\n%s", text)
+	}
+	if strings.Contains(text, "<= 1ms") || strings.Contains(text, "\nDNS Lookup\n") {
+		t.Errorf("text output draws empty buckets or phases:\n%s", text)
+	}
+}
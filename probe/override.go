@@ -0,0 +1,174 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ResolveRule pins a host and port to fixed addresses, like curl's
+// --resolve, so no DNS lookup is made for it
+type ResolveRule struct {
+	Host  string // Host name, or "*" for any host
+	Port  string
+	Addrs []string // IP addresses, tried in order
+}
+
+// ConnectToRule redirects connections for a host and port to another
+// one, like curl's --connect-to. The request, including its Host header and
+// TLS server name, still targets the original host. Empty fields match any
+// host or port, or keep the original one.
+type ConnectToRule struct {
+	Host       string
+	Port       string
+	TargetHost string
+	TargetPort string
+}
+
+// ParseResolve parses a -resolve rule of the form host:port:addr[,addr...].
+// IPv6 addresses may be bracketed.
+func ParseResolve(s string) (ResolveRule, error) {
+	fields, err := splitRule(s, 3)
+	if err != nil || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+		return ResolveRule{}, fmt.Errorf("invalid resolve rule %q, expected host:port:addr[,addr...]", s)
+	}
+	rule := ResolveRule{Host: fields[0], Port: fields[1]}
+	if err := validatePort(rule.Port); err != nil {
+		return ResolveRule{}, fmt.Errorf("invalid resolve rule %q: %w", s, err)
+	}
+	for _, addr := range strings.Split(fields[2], ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return ResolveRule{}, fmt.Errorf("invalid resolve rule %q: %q is not an IP address", s, addr)
+		}
+		rule.Addrs = append(rule.Addrs, ip.String())
+	}
+	return rule, nil
+}
+
+// ParseConnectTo parses a -connect-to rule of the form
+// host:port:host2:port2, where any field may be empty
+func ParseConnectTo(s string) (ConnectToRule, error) {
+	fields, err := splitRule(s, 4)
+	if err != nil {
+		return ConnectToRule{}, fmt.Errorf("invalid connect-to rule %q, expected host:port:host2:port2", s)
+	}
+	rule := ConnectToRule{Host: fields[0], Port: fields[1], TargetHost: fields[2], TargetPort: fields[3]}
+	for _, port := range []string{rule.Port, rule.TargetPort} {
+		if port == "" {
+			continue
+		}
+		if err := validatePort(port); err != nil {
+			return ConnectToRule{}, fmt.Errorf("invalid connect-to rule %q: %w", s, err)
+		}
+	}
+	return rule, nil
+}
+
+// splitRule splits a colon-separated rule into n fields. Only the last
+// field may contain colons, unless an earlier field is a bracketed IPv6
+// address, whose brackets are removed.
+func splitRule(s string, n int) ([]string, error) {
+	fields := make([]string, 0, n)
+	for len(fields) < n-1 {
+		var field string
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']'")
+			}
+			field, s = s[1:end], s[end+1:]
+			if !strings.HasPrefix(s, ":") {
+				return nil, fmt.Errorf("missing ':'")
+			}
+			s = s[1:]
+		} else {
+			var ok bool
+			if field, s, ok = strings.Cut(s, ":"); !ok {
+				return nil, fmt.Errorf("missing ':'")
+			}
+		}
+		fields = append(fields, field)
+	}
+	return append(fields, s), nil
+}
+
+// validatePort checks that port is a valid port number
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// DialOverride records how -connect-to and -resolve rules changed the
+// address a hop connected to
+type DialOverride struct {
+	Address   string   // Address the request asked for
+	ConnectTo string   // Address substituted by a connect-to rule, empty if none matched
+	Resolve   []string // Addresses substituted by a resolve rule, empty if none matched
+}
+
+// dialOverrides applies -connect-to and -resolve rules to dialed addresses
+type dialOverrides struct {
+	resolve   []ResolveRule
+	connectTo []ConnectToRule
+}
+
+// apply returns the address to dial in place of address, and the addresses
+// it resolves to when a resolve rule matches. Connect-to rules are applied
+// first, so the host they substitute can itself be resolved by a rule. It
+// returns nil when no rule matched.
+func (o dialOverrides) apply(address string) (*DialOverride, error) {
+	if len(o.resolve) == 0 && len(o.connectTo) == 0 {
+		return nil, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	override := &DialOverride{Address: address}
+	for _, rule := range o.connectTo {
+		if (rule.Host == "" || strings.EqualFold(rule.Host, host)) && (rule.Port == "" || rule.Port == port) {
+			if rule.TargetHost != "" {
+				host = rule.TargetHost
+			}
+			if rule.TargetPort != "" {
+				port = rule.TargetPort
+			}
+			override.ConnectTo = net.JoinHostPort(host, port)
+			break
+		}
+	}
+	for _, rule := range o.resolve {
+		if (rule.Host == "*" || strings.EqualFold(rule.Host, host)) && rule.Port == port {
+			for _, addr := range rule.Addrs {
+				override.Resolve = append(override.Resolve, net.JoinHostPort(addr, port))
+			}
+			break
+		}
+	}
+
+	if override.ConnectTo == "" && len(override.Resolve) == 0 {
+		return nil, nil
+	}
+	return override, nil
+}
+
+// DialOverrideJSON represents a dial override in JSON format
+type DialOverrideJSON struct {
+	Address   string   `json:"address"`
+	ConnectTo string   `json:"connect_to,omitempty"`
+	Resolve   []string `json:"resolve,omitempty"`
+}
+
+// JSON converts the dial override into its JSON representation
+func (o *DialOverride) JSON() *DialOverrideJSON {
+	if o == nil {
+		return nil
+	}
+	return &DialOverrideJSON{Address: o.Address, ConnectTo: o.ConnectTo, Resolve: o.Resolve}
+}
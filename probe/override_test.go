@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ResolveRule
+		wantErr string
+	}{
+		{
+			input: "example.com:443:192.0.2.1",
+			want:  ResolveRule{Host: "example.com", Port: "443", Addrs: []string{"192.0.2.1"}},
+		},
+		{
+			input: "example.com:80:192.0.2.1, 2001:db8::1,[2001:db8::2]",
+			want:  ResolveRule{Host: "example.com", Port: "80", Addrs: []string{"192.0.2.1", "2001:db8::1", "2001:db8::2"}},
+		},
+		{
+			input: "[2001:db8::1]:443:[::1]",
+			want:  ResolveRule{Host: "2001:db8::1", Port: "443", Addrs: []string{"::1"}},
+		},
+		{
+			input: "*:443:192.0.2.1",
+			want:  ResolveRule{Host: "*", Port: "443", Addrs: []string{"192.0.2.1"}},
+		},
+		{input: "example.com::192.0.2.1", wantErr: "expected host:port:addr"},
+		{input: ":443:192.0.2.1", wantErr: "expected host:port:addr"},
+		{input: "example.com:443:", wantErr: "expected host:port:addr"},
+		{input: "example.com:443", wantErr: "expected host:port:addr"},
+		{input: "example.com", wantErr: "expected host:port:addr"},
+		{input: "example.com:https:192.0.2.1", wantErr: "invalid port"},
+		{input: "example.com:65536:192.0.2.1", wantErr: "invalid port"},
+		{input: "example.com:443:backend.example.com", wantErr: "not an IP address"},
+		{input: "example.com:443:192.0.2.1,", wantErr: "not an IP address"},
+		{input: "[2001:db8::1:443:192.0.2.1", wantErr: "expected host:port:addr"},
+		{input: "[2001:db8::1]443:192.0.2.1", wantErr: "expected host:port:addr"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseResolve(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseResolve(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseResolve(%q) error = %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseResolve(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseConnectTo(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ConnectToRule
+		wantErr string
+	}{
+		{
+			input: "example.com:443:backend.example.com:8443",
+			want:  ConnectToRule{Host: "example.com", Port: "443", TargetHost: "backend.example.com", TargetPort: "8443"},
+		},
+		{
+			input: "::backend.example.com:",
+			want:  ConnectToRule{TargetHost: "backend.example.com"},
+		},
+		{
+			input: "example.com:443::8443",
+			want:  ConnectToRule{Host: "example.com", Port: "443", TargetPort: "8443"},
+		},
+		{
+			input: "[2001:db8::1]:443:[2001:db8::2]:8443",
+			want:  ConnectToRule{Host: "2001:db8::1", Port: "443", TargetHost: "2001:db8::2", TargetPort: "8443"},
+		},
+		{
+			input: ":::",
+			want:  ConnectToRule{},
+		},
+		{input: "example.com:443:backend.example.com", wantErr: "expected host:port:host2:port2"},
+		{input: "example.com", wantErr: "expected host:port:host2:port2"},
+		{input: "example.com:443:[2001:db8::2:8443", wantErr: "expected host:port:host2:port2"},
+		{input: "example.com:0:backend.example.com:443", wantErr: "invalid port"},
+		{input: "example.com:443:backend.example.com:https", wantErr: "invalid port"},
+		{input: "example.com:443:backend.example.com:443:1", wantErr: "invalid port"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseConnectTo(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseConnectTo(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseConnectTo(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseConnectTo(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRule(t *testing.T) {
+	tests := []struct {
+		input   string
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		{"a:b:c", 3, []string{"a", "b", "c"}, false},
+		{"a:b:c:d", 3, []string{"a", "b", "c:d"}, false},
+		{"[::1]:b:c", 3, []string{"::1", "b", "c"}, false},
+		{"a:[::1]:c", 3, []string{"a", "::1", "c"}, false},
+		{"::", 3, []string{"", "", ""}, false},
+		{"a:b", 3, nil, true},
+		{"[::1", 3, nil, true},
+		{"[::1]b:c", 3, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := splitRule(tt.input, tt.n)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitRule(%q, %d) = %q, %v, want %q, error %v", tt.input, tt.n, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDialOverridesApply(t *testing.T) {
+	overrides := dialOverrides{
+		resolve: []ResolveRule{
+			{Host: "backend.example.com", Port: "8443", Addrs: []string{"192.0.2.10", "2001:db8::10"}},
+			{Host: "*", Port: "8080", Addrs: []string{"192.0.2.80"}},
+		},
+		connectTo: []ConnectToRule{
+			{Host: "example.com", Port: "443", TargetHost: "backend.example.com", TargetPort: "8443"},
+			{Port: "9000", TargetPort: "9001"},
+		},
+	}
+
+	tests := []struct {
+		address string
+		want    *DialOverride
+	}{
+		{
+			// Connect-to applies first, and the target is then resolved
+			address: "EXAMPLE.com:443",
+			want: &DialOverride{
+				Address:   "EXAMPLE.com:443",
+				ConnectTo: "backend.example.com:8443",
+				Resolve:   []string{"192.0.2.10:8443", "[2001:db8::10]:8443"},
+			},
+		},
+		{
+			address: "backend.example.com:8443",
+			want:    &DialOverride{Address: "backend.example.com:8443", Resolve: []string{"192.0.2.10:8443", "[2001:db8::10]:8443"}},
+		},
+		{
+			// A connect-to rule without a host matches any host
+			address: "other.example.com:9000",
+			want:    &DialOverride{Address: "other.example.com:9000", ConnectTo: "other.example.com:9001"},
+		},
+		{
+			// A resolve rule for "*" matches any host
+			address: "[2001:db8::1]:8080",
+			want:    &DialOverride{Address: "[2001:db8::1]:8080", Resolve: []string{"192.0.2.80:8080"}},
+		},
+		{address: "example.com:80"},
+		{address: "backend.example.com:443"},
+	}
+
+	for _, tt := range tests {
+		got, err := overrides.apply(tt.address)
+		if err != nil {
+			t.Errorf("apply(%q) error = %v", tt.address, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("apply(%q) = %+v, want %+v", tt.address, got, tt.want)
+		}
+	}
+
+	if got, err := (dialOverrides{}).apply("example.com:443"); got != nil || err != nil {
+		t.Errorf("apply without rules = %+v, %v, want nil", got, err)
+	}
+}
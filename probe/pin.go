@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// PhasePin is the trace and error phase of certificate pin verification
+const PhasePin = "pin"
+
+// pinPrefix is the only pin hash algorithm supported
+const pinPrefix = "sha256//"
+
+// ParsePin validates a pin of the form sha256//BASE64, where BASE64 is the
+// SHA-256 hash of a certificate's SubjectPublicKeyInfo
+func ParsePin(s string) (string, error) {
+	if !strings.HasPrefix(s, pinPrefix) {
+		return "", fmt.Errorf("invalid pin %q, expected sha256//BASE64", s)
+	}
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, pinPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return "", fmt.Errorf("invalid pin %q, expected a base64 SHA-256 hash", s)
+	}
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash), nil
+}
+
+// SPKIPin returns the pin of a certificate's public key
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// PinMatch records which certificate of the chain matched a pin
+type PinMatch struct {
+	Chain    int // Index of the verified chain holding the certificate, 0 when the chain was not verified
+	Position int // Position in the chain, leaf first
+	Pin      string
+	Subject  string
+}
+
+// PinError is returned when no certificate of the chain matches a pin
+type PinError struct {
+	Chain []string // Pins of the chains' certificates, leaf first, each listed once
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch: no pinned key in chain %s", strings.Join(e.Chain, ", "))
+}
+
+// pinnedChains returns the chains pins are checked against: every verified
+// chain, which includes its trusted root, or the chain as sent when the
+// connection was not verified. A cross-signed certificate can lead to
+// several verified chains through different intermediates and roots.
+func pinnedChains(cs *tls.ConnectionState) [][]*x509.Certificate {
+	if len(cs.VerifiedChains) > 0 {
+		return cs.VerifiedChains
+	}
+	return [][]*x509.Certificate{cs.PeerCertificates}
+}
+
+// matchPins returns the first certificate of the chains whose key is
+// pinned, or nil if none is
+func matchPins(chains [][]*x509.Certificate, pins []string) *PinMatch {
+	for c, chain := range chains {
+		for i, cert := range chain {
+			pin := SPKIPin(cert)
+			for _, p := range pins {
+				if p == pin {
+					return &PinMatch{Chain: c, Position: i, Pin: pin, Subject: cert.Subject.String()}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyPins builds a VerifyConnection callback that fails the handshake
+// unless a certificate of the chains matches one of the pins
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		chains := pinnedChains(&cs)
+		if matchPins(chains, pins) != nil {
+			return nil
+		}
+		pinErr := &PinError{}
+		seen := make(map[string]bool)
+		for _, chain := range chains {
+			for _, cert := range chain {
+				if pin := SPKIPin(cert); !seen[pin] {
+					seen[pin] = true
+					pinErr.Chain = append(pinErr.Chain, pin)
+				}
+			}
+		}
+		return pinErr
+	}
+}
+
+// PinMatchJSON represents a pin match in JSON format
+type PinMatchJSON struct {
+	Chain    int    `json:"chain"`
+	Position int    `json:"position"`
+	Pin      string `json:"pin"`
+	Subject  string `json:"subject"`
+}
@@ -0,0 +1,288 @@
+package probe
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a generated certificate and its private key
+type testCert struct {
+	*x509.Certificate
+	key crypto.Signer
+}
+
+// issueCert creates a certificate from template, signed by parent or
+// self-signed when parent is nil. key is the certificate's own key, a new
+// P-256 key when nil. Unset serial numbers and validity periods get
+// defaults valid around the current time.
+func issueCert(t *testing.T, template *x509.Certificate, parent *testCert, key crypto.Signer) *testCert {
+	t.Helper()
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if template.SerialNumber == nil {
+		serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.SerialNumber = serial
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(90 * 24 * time.Hour)
+	}
+
+	signer, parentCert := key, template
+	if parent != nil {
+		signer, parentCert = parent.key, parent.Certificate
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{Certificate: cert, key: key}
+}
+
+// caTemplate returns the template of a CA certificate named name
+func caTemplate(name string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// leafTemplate returns the template of a server certificate for 127.0.0.1
+// and pin.test
+func leafTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "pin.test"},
+		DNSNames:    []string{"pin.test"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+// testChain is a leaf, intermediate and root
+type testChain struct {
+	leaf, intermediate, root *testCert
+}
+
+func newTestChain(t *testing.T) testChain {
+	root := issueCert(t, caTemplate("Test Root"), nil, nil)
+	intermediate := issueCert(t, caTemplate("Test Intermediate"), root, nil)
+	return testChain{
+		leaf:         issueCert(t, leafTemplate(), intermediate, nil),
+		intermediate: intermediate,
+		root:         root,
+	}
+}
+
+// roots returns a pool trusting the chain's root
+func (c testChain) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.root.Certificate)
+	return pool
+}
+
+// newChainServer starts a TLS server presenting the leaf and intermediate
+// of chain
+func newChainServer(t *testing.T, chain testChain) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{chain.leaf.Raw, chain.intermediate.Raw},
+		PrivateKey:  chain.leaf.key,
+	}}}
+	// Handshakes failed by the client are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParsePin(t *testing.T) {
+	hash := sha256.Sum256([]byte("key"))
+	valid := base64.StdEncoding.EncodeToString(hash[:])
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{input: "sha256//" + valid, want: "sha256//" + valid},
+		{input: valid, wantErr: "expected sha256//BASE64"},
+		{input: "sha1//" + valid, wantErr: "expected sha256//BASE64"},
+		{input: "SHA256//" + valid, wantErr: "expected sha256//BASE64"},
+		{input: "sha256//not base64!", wantErr: "expected a base64 SHA-256 hash"},
+		{input: "sha256//" + base64.StdEncoding.EncodeToString(hash[:20]), wantErr: "expected a base64 SHA-256 hash"},
+		{input: "sha256//" + base64.StdEncoding.EncodeToString(append(hash[:], 0)), wantErr: "expected a base64 SHA-256 hash"},
+		{input: "sha256//", wantErr: "expected a base64 SHA-256 hash"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePin(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParsePin(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePin(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestPinMatchPositions(t *testing.T) {
+	chain := newTestChain(t)
+	server := newChainServer(t, chain)
+
+	for position, cert := range []*testCert{chain.leaf, chain.intermediate, chain.root} {
+		result, err := Run(context.Background(), Options{
+			URL:     server.URL,
+			Timeout: 5 * time.Second,
+			TLS:     TLSOptions{RootCAs: chain.roots(), Pins: []string{SPKIPin(cert.Certificate)}},
+		})
+		if err != nil {
+			t.Errorf("probe pinned to %s failed: %v", cert.Subject, err)
+			continue
+		}
+		match := result.TLS.Pin
+		if match == nil || match.Position != position || match.Subject != cert.Subject.String() {
+			t.Errorf("pin of %s matched %+v, want position %d", cert.Subject, match, position)
+		}
+	}
+}
+
+func TestPinMismatch(t *testing.T) {
+	chain := newTestChain(t)
+	server := newChainServer(t, chain)
+	other := issueCert(t, caTemplate("Other Root"), nil, nil)
+
+	_, err := Run(context.Background(), Options{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		TLS:     TLSOptions{RootCAs: chain.roots(), Pins: []string{SPKIPin(other.Certificate)}},
+	})
+	if phase := ErrorPhase(err); phase != PhasePin {
+		t.Fatalf("error phase = %q, want %q (error %v)", phase, PhasePin, err)
+	}
+	var pinErr *PinError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("error %v is not a PinError", err)
+	}
+	// The verified chain is listed, including the trusted root
+	want := []string{SPKIPin(chain.leaf.Certificate), SPKIPin(chain.intermediate.Certificate), SPKIPin(chain.root.Certificate)}
+	if !reflect.DeepEqual(pinErr.Chain, want) {
+		t.Errorf("mismatch lists %v, want %v", pinErr.Chain, want)
+	}
+}
+
+func TestPinInsecureUsesSentChain(t *testing.T) {
+	chain := newTestChain(t)
+	server := newChainServer(t, chain)
+
+	result, err := Run(context.Background(), Options{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		TLS:     TLSOptions{Insecure: true, Pins: []string{SPKIPin(chain.intermediate.Certificate)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match := result.TLS.Pin; match == nil || match.Position != 1 {
+		t.Errorf("intermediate pin matched %+v, want position 1", match)
+	}
+
+	// The root is not sent, so without verification it cannot match
+	_, err = Run(context.Background(), Options{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		TLS:     TLSOptions{Insecure: true, Pins: []string{SPKIPin(chain.root.Certificate)}},
+	})
+	var pinErr *PinError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("root pin with -insecure: error %v, want a PinError", err)
+	}
+	want := []string{SPKIPin(chain.leaf.Certificate), SPKIPin(chain.intermediate.Certificate)}
+	if !reflect.DeepEqual(pinErr.Chain, want) {
+		t.Errorf("mismatch lists %v, want the sent chain %v", pinErr.Chain, want)
+	}
+}
+
+func TestPinMatchesAnyVerifiedChain(t *testing.T) {
+	// The new root is trusted itself and also cross-signed by the old one,
+	// so the leaf verifies through either root
+	oldRoot := issueCert(t, caTemplate("Old Root"), nil, nil)
+	newRoot := issueCert(t, caTemplate("New Root"), nil, nil)
+	crossSigned := issueCert(t, caTemplate("New Root"), oldRoot, newRoot.key)
+	intermediate := issueCert(t, caTemplate("Test Intermediate"), newRoot, nil)
+	leaf := issueCert(t, leafTemplate(), intermediate, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(oldRoot.Certificate)
+	roots.AddCert(newRoot.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Certificate)
+	intermediates.AddCert(crossSigned.Certificate)
+	chains, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, DNSName: "pin.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 2 {
+		t.Fatalf("leaf verified through %d chains, want 2", len(chains))
+	}
+	cs := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf.Certificate, intermediate.Certificate}, VerifiedChains: chains}
+
+	for _, root := range []*testCert{oldRoot, newRoot} {
+		pins := []string{SPKIPin(root.Certificate)}
+		if err := verifyPins(pins)(cs); err != nil {
+			t.Errorf("pin of %s: %v", root.Subject, err)
+			continue
+		}
+		match := matchPins(pinnedChains(&cs), pins)
+		if match == nil {
+			t.Errorf("pin of %s did not match", root.Subject)
+			continue
+		}
+		if got := chains[match.Chain][match.Position]; SPKIPin(got) != pins[0] {
+			t.Errorf("pin of %s matched %s at chain %d position %d", root.Subject, got.Subject, match.Chain, match.Position)
+		}
+	}
+
+	// The old root is only part of the longer chain
+	match := matchPins(pinnedChains(&cs), []string{SPKIPin(oldRoot.Certificate)})
+	if match == nil || len(chains[match.Chain]) != 4 || match.Position != 3 {
+		t.Errorf("old root pin matched %+v, want the last position of the cross-signed chain", match)
+	}
+}
@@ -0,0 +1,205 @@
+// Package probe measures the latency of each phase of an HTTP request
+// (DNS lookup, TCP connect, TLS handshake, TTFB and TTLB) across the
+// whole redirect chain.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultMaxRedirects is used when Options.MaxRedirects is zero
+const DefaultMaxRedirects = 5
+
+// Options configures a probe
+type Options struct {
+	URL           string
+	HTTP1         bool            // Use HTTP/1.0
+	HTTP11        bool            // Use HTTP/1.1
+	NoKeepAlive   bool            // Disable keep-alive connections
+	Timeout       time.Duration   // Overall request timeout, zero means no timeout
+	MaxRedirects  int             // Maximum number of redirects to follow
+	DNSServers    []string        // Custom DNS servers, IP addresses or udp, tcp, tls and https URIs
+	Resolve       []ResolveRule   // Fixed addresses for host and port pairs, like curl's --resolve
+	ConnectTo     []ConnectToRule // Connection targets substituted for host and port pairs
+	DNSStrategy   string          // DNSRoundRobin, DNSFirstHealthy or DNSFastest, round-robin when empty
+	PreferIPv6    bool            // Prefer IPv6 connections over IPv4, without racing the families
+	FallbackDelay time.Duration   // Happy Eyeballs delay before racing the other family, 300ms when zero, disabled when negative
+	IPFamily      string          // FamilyIPv4 or FamilyIPv6 to only connect over that family, any when empty
+	Method        string          // HTTP method, GET when empty
+	Header        http.Header     // Extra request headers, including Host
+	Body          []byte          // Request body, resent on every run
+	TLS           TLSOptions      // TLS client settings for HTTPS hops
+	CertWarnDays  int             // Warn when a certificate expires within this many days
+	CertCritDays  int             // Fail when a certificate expires within this many days
+}
+
+// certChecks reports whether certificate checks were requested
+func (o Options) certChecks() bool {
+	return o.CertWarnDays > 0 || o.CertCritDays > 0
+}
+
+// Probe issues traced HTTP requests. A Probe may be run several times, in
+// which case idle connections are reused between runs when keep-alive is on.
+type Probe struct {
+	opts           Options
+	client         *http.Client
+	dial           dialContextFunc // Dialer shared with the transport
+	overrides      dialOverrides
+	resolver       *net.Resolver
+	customResolver bool
+}
+
+// New creates a probe from the given options
+func New(opts Options) (*Probe, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("no URL given")
+	}
+	if opts.IPFamily != "" && opts.IPFamily != FamilyIPv4 && opts.IPFamily != FamilyIPv6 {
+		return nil, fmt.Errorf("invalid IP family %q, expected %s or %s", opts.IPFamily, FamilyIPv4, FamilyIPv6)
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+	opts.URL = NormalizeURL(opts.URL)
+
+	// Set up DNS resolver if custom servers are provided
+	resolver := net.DefaultResolver
+	if len(opts.DNSServers) > 0 {
+		var err error
+		if resolver, err = createCustomResolver(opts.DNSServers, opts.DNSStrategy); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create base dialer
+	baseDialer := &net.Dialer{
+		Timeout:       30 * time.Second,
+		KeepAlive:     30 * time.Second,
+		Resolver:      resolver,
+		FallbackDelay: opts.FallbackDelay,
+	}
+	if opts.PreferIPv6 {
+		// IPv6 addresses are dialed first, without racing IPv4 (Happy Eyeballs)
+		baseDialer.FallbackDelay = -1
+	}
+
+	// Create custom dialer with IPv6 preference
+	dialer := &customDialer{
+		Dialer:     baseDialer,
+		preferIPv6: opts.PreferIPv6 && opts.IPFamily == "",
+		family:     opts.IPFamily,
+		overrides:  dialOverrides{resolve: opts.Resolve, connectTo: opts.ConnectTo},
+	}
+
+	base := createTransport(opts.HTTP1, opts.HTTP11, opts.NoKeepAlive, dialer.DialContext, opts.TLS)
+	var transport http.RoundTripper = base
+	if opts.TLS.ServerName != "" {
+		// The server name only applies to the probed host, not to redirects elsewhere
+		u, err := url.Parse(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URL: %w", err)
+		}
+		otherTLS := opts.TLS
+		otherTLS.ServerName = ""
+		transport = &sniTransport{
+			host:  u.Hostname(),
+			sni:   base,
+			other: createTransport(opts.HTTP1, opts.HTTP11, opts.NoKeepAlive, dialer.DialContext, otherTLS),
+		}
+	}
+
+	return &Probe{
+		opts: opts,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+		dial:           dialer.DialContext,
+		overrides:      dialer.overrides,
+		resolver:       resolver,
+		customResolver: resolver != net.DefaultResolver,
+	}, nil
+}
+
+// Run executes a single probe against the configured URL
+func (p *Probe) Run(ctx context.Context) (*Result, error) {
+	rec := newTraceRecorder(p.customResolver, p.opts.TLS.Pins)
+	redirects := make([]RedirectInfo, 0)
+	var firstTiming Timing
+	var firstRequest RequestInfo
+
+	// Each run gets its own redirect bookkeeping on top of the shared transport
+	client := *p.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return handleRedirect(req, via, &redirects, p.opts.MaxRedirects, rec)
+	}
+
+	// Create and execute request
+	req, err := createRequest(ctx, p.opts, &firstTiming, &firstRequest, rec)
+	if err != nil {
+		return nil, &PhaseError{Phase: PhaseRequest, Err: fmt.Errorf("error creating request: %w", err)}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		phase := rec.currentPhase()
+		var pinErr *PinError
+		if errors.As(err, &pinErr) {
+			phase = PhasePin
+		}
+		return nil, &PhaseError{Phase: phase, Err: fmt.Errorf("error making request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	// Redirects replace the timing and request objects, so take the final hop's from its request
+	finalCtx := resp.Request.Context()
+	timing := finalCtx.Value(timingContextKey{}).(*Timing)
+	request := finalCtx.Value(requestInfoContextKey{}).(*RequestInfo)
+	start := finalCtx.Value(startTimeContextKey{}).(time.Time)
+
+	// Process response body and timing
+	bodyStart := time.Now()
+	bodySize, err := processResponseBody(resp, timing, bodyStart, start, rec)
+	if err != nil {
+		return nil, &PhaseError{Phase: PhaseResponse, Err: fmt.Errorf("error processing response: %w", err)}
+	}
+
+	result := &Result{
+		URL:            resp.Request.URL.String(),
+		HTTPProtocol:   resp.Proto,
+		StatusCode:     resp.StatusCode,
+		Status:         resp.Status,
+		ResponseHeader: resp.Header,
+		BodySize:       bodySize,
+		StartTime:      start,
+		Timing:         rec.snapshot(timing),
+		Request:        rec.snapshotRequest(request),
+		DNS:            rec.dnsInfo(),
+		DialOverride:   rec.dialOverrideInfo(),
+		TLS:            rec.tlsInfo(resp),
+		Connects:       rec.connectAttempts(),
+		Redirects:      redirects,
+		TraceEvents:    rec.Events(),
+	}
+	result.LocalAddr, result.RemoteAddr = rec.connAddrs()
+	result.Family, result.FamilyFallback = rec.connFamily()
+	if p.opts.certChecks() {
+		result.CertCheck = checkCertificates(result, p.opts.CertWarnDays, p.opts.CertCritDays, p.opts.TLS.RootCAs, time.Now())
+	}
+	return result, nil
+}
+
+// Run creates a probe from opts and executes it once
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	p, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.Run(ctx)
+}
@@ -0,0 +1,85 @@
+package probe
+
+import (
+	"context"
+	"time"
+)
+
+// RepeatOptions controls how a probe is repeated. The run stops after Count
+// samples or once Duration has elapsed, whichever comes first; a zero value
+// disables that limit.
+type RepeatOptions struct {
+	Count    int
+	Duration time.Duration
+	Interval time.Duration // Pause between samples
+}
+
+// RepeatResult holds the samples and statistics of a repeated probe
+type RepeatResult struct {
+	URL     string
+	Results []*Result
+	Errors  []error
+	Stats   Stats
+}
+
+// Repeat runs the probe repeatedly and computes per-phase statistics from
+// the final hop of every successful sample
+func (p *Probe) Repeat(ctx context.Context, ro RepeatOptions) *RepeatResult {
+	repeat := &RepeatResult{URL: p.opts.URL}
+	if ro.Count <= 0 && ro.Duration <= 0 {
+		ro.Count = 1
+	}
+
+	var deadline time.Time
+	if ro.Duration > 0 {
+		deadline = time.Now().Add(ro.Duration)
+	}
+
+	for i := 0; ro.Count <= 0 || i < ro.Count; i++ {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			break
+		}
+		if i > 0 && ro.Interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(ro.Interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		result, err := p.Run(ctx)
+		if err != nil {
+			repeat.Errors = append(repeat.Errors, err)
+			continue
+		}
+		repeat.Results = append(repeat.Results, result)
+	}
+
+	timings := make([]Timing, 0, len(repeat.Results))
+	for _, result := range repeat.Results {
+		timings = append(timings, result.Timing)
+	}
+	repeat.Stats = ComputeStats(timings)
+	return repeat
+}
+
+// RepeatJSON represents a repeated probe in JSON format
+type RepeatJSON struct {
+	URL    string    `json:"url"`
+	Errors []string  `json:"errors,omitempty"`
+	Stats  StatsJSON `json:"stats"`
+}
+
+// JSON converts the repeated probe into its JSON representation
+func (r *RepeatResult) JSON() RepeatJSON {
+	result := RepeatJSON{
+		URL:   r.URL,
+		Stats: r.Stats.JSON(),
+	}
+	for _, err := range r.Errors {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// handleRedirect handles HTTP redirects and collects timing information
+func handleRedirect(req *http.Request, via []*http.Request, redirects *[]RedirectInfo, maxRedirects int, rec *traceRecorder) error {
+	lastResponse := req.Response
+	if lastResponse != nil {
+		if timing, ok := lastResponse.Request.Context().Value(timingContextKey{}).(*Timing); ok {
+			var requestInfo RequestInfo
+			if info, ok := lastResponse.Request.Context().Value(requestInfoContextKey{}).(*RequestInfo); ok {
+				requestInfo = rec.snapshotRequest(info)
+			}
+
+			redirectInfo := RedirectInfo{
+				URL:            lastResponse.Request.URL.String(),
+				HTTPProtocol:   lastResponse.Proto,
+				StatusCode:     lastResponse.StatusCode,
+				Status:         lastResponse.Status,
+				ResponseHeader: lastResponse.Header,
+				StartTime:      lastResponse.Request.Context().Value(startTimeContextKey{}).(time.Time),
+				EndTime:        time.Now(),
+				Timing:         rec.snapshot(timing),
+				Request:        requestInfo,
+				DNS:            rec.dnsInfo(),
+				DialOverride:   rec.dialOverrideInfo(),
+				TLS:            rec.tlsInfo(lastResponse),
+				Connects:       rec.connectAttempts(),
+			}
+			redirectInfo.LocalAddr, redirectInfo.RemoteAddr = rec.connAddrs()
+			redirectInfo.Family, redirectInfo.FamilyFallback = rec.connFamily()
+
+			// Close the hop so the next request starts with fresh deduplication state
+			redirectInfo.TraceEvents = rec.nextHop()
+			*redirects = append(*redirects, redirectInfo)
+
+			// Create new timing and request objects for the next request
+			nextTiming := &Timing{}
+			nextRequest := &RequestInfo{Method: req.Method, BodySize: req.ContentLength}
+			*req = *req.WithContext(withTrace(req.Context(), nextTiming, nextRequest, rec))
+		}
+	}
+
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects (max: %d)", len(via), maxRedirects)
+	}
+	return nil
+}
+
+// createRequest creates a new HTTP request with tracing enabled
+func createRequest(ctx context.Context, opts Options, timing *Timing, request *RequestInfo, rec *traceRecorder) (*http.Request, error) {
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if opts.Body != nil {
+		body = bytes.NewReader(opts.Body)
+	}
+
+	ctx = context.WithValue(ctx, traceRecorderContextKey{}, rec)
+	req, err := http.NewRequestWithContext(ctx, method, opts.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range opts.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	// The Host header is sent from req.Host, not from the header map
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	request.Method = req.Method
+	request.BodySize = req.ContentLength
+	req = req.WithContext(withTrace(req.Context(), timing, request, rec))
+
+	return req, nil
+}
+
+// withTrace attaches a tracer for the recorder's current hop to ctx, along
+// with the hop's start time, timing and request information
+func withTrace(ctx context.Context, timing *Timing, request *RequestInfo, rec *traceRecorder) context.Context {
+	trace := createTracer(timing, request, rec)
+	ctx = httptrace.WithClientTrace(ctx, trace)
+	ctx = context.WithValue(ctx, startTimeContextKey{}, time.Now())
+	ctx = context.WithValue(ctx, timingContextKey{}, timing)
+	return context.WithValue(ctx, requestInfoContextKey{}, request)
+}
+
+// processResponseBody reads the response body, updates timing information
+// and returns the body size
+func processResponseBody(resp *http.Response, timing *Timing, bodyStart, start time.Time, rec *traceRecorder) (int64, error) {
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return n, err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	timing.ContentTransfer = time.Since(bodyStart)
+	rec.addTraceEventLocked(PhaseResponse, "body_done", nil, "Response body fully read (TTLB)")
+	timing.Total = time.Since(start)
+	return n, nil
+}
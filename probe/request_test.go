@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateRequestHostHeader(t *testing.T) {
+	opts := Options{
+		URL:    "http://127.0.0.1:8080/",
+		Header: http.Header{"Host": {"example.com"}, "X-Test": {"a", "b"}},
+	}
+	req, err := createRequest(context.Background(), opts, &Timing{}, &RequestInfo{}, newTraceRecorder(false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Host != "example.com" {
+		t.Errorf("req.Host = %q, want example.com", req.Host)
+	}
+	if _, ok := req.Header["Host"]; ok {
+		t.Errorf("Host left in the header map: %v", req.Header)
+	}
+	if got := req.Header.Values("X-Test"); len(got) != 2 {
+		t.Errorf("X-Test = %q, want both values", got)
+	}
+	// The caller's header is not modified
+	if opts.Header.Get("Host") != "example.com" {
+		t.Errorf("options header lost its Host: %v", opts.Header)
+	}
+
+	req, err = createRequest(context.Background(), Options{URL: "http://127.0.0.1:8080/"}, &Timing{}, &RequestInfo{}, newTraceRecorder(false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Host != "127.0.0.1:8080" || req.Method != http.MethodGet {
+		t.Errorf("default request: %s with host %q, want GET with the URL host", req.Method, req.Host)
+	}
+}
+
+func TestRunSendsHostAndBody(t *testing.T) {
+	type seen struct {
+		method, host, contentType, body string
+	}
+	got := make(chan seen, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- seen{r.Method, r.Host, r.Header.Get("Content-Type"), string(body)}
+	}))
+	defer server.Close()
+
+	result, err := Run(context.Background(), Options{
+		URL:     server.URL,
+		Timeout: 5 * time.Second,
+		Method:  http.MethodPost,
+		Header:  http.Header{"Host": {"example.com"}, "Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:    []byte("a=1&b=2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := seen{http.MethodPost, "example.com", "application/x-www-form-urlencoded", "a=1&b=2"}
+	if s := <-got; s != want {
+		t.Errorf("server saw %+v, want %+v", s, want)
+	}
+	if result.Request.BodySize != 7 {
+		t.Errorf("request body size = %d, want 7", result.Request.BodySize)
+	}
+	if host := result.Request.Header.Get("Host"); host != "example.com" {
+		t.Errorf("recorded Host = %q, want example.com", host)
+	}
+}
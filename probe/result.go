@@ -0,0 +1,275 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Result holds the outcome of a single probe, including every redirect hop
+type Result struct {
+	URL            string
+	HTTPProtocol   string
+	StatusCode     int
+	Status         string
+	ResponseHeader http.Header // Response header of the final hop
+	BodySize       int64       // Response body size of the final hop
+	StartTime      time.Time
+	Timing         Timing
+	Request        RequestInfo
+	DNS            *DNSInfo         // DNS lookup of the final hop, nil when no lookup was made
+	DialOverride   *DialOverride    // Rules applied to the final hop's connection, if any
+	LocalAddr      string           // Local address and port of the final hop's connection
+	RemoteAddr     string           // Server address and port of the final hop's connection
+	Family         string           // IP family of the final hop's connection
+	FamilyFallback bool             // Final hop connected over another family than first attempted
+	Connects       []ConnectAttempt // Connection attempts of the final hop
+	TLS            *TLSInfo         // TLS details of the final hop, nil for plain HTTP
+	Redirects      []RedirectInfo
+	TraceEvents    []TraceEvent
+	Browser        *BrowserTiming // Set by browser probes only
+	CertCheck      *CertCheck     // Set when certificate checks were requested
+}
+
+// TotalTime returns the time from the start of the first hop to the end of
+// the final response
+func (r *Result) TotalTime() time.Duration {
+	if len(r.Redirects) > 0 {
+		return r.Timing.Total + r.StartTime.Sub(r.Redirects[0].StartTime)
+	}
+	return r.Timing.Total
+}
+
+// FirstHop returns the timing of the first hop, the only one made to the
+// requested URL
+func (r *Result) FirstHop() Timing {
+	if len(r.Redirects) > 0 {
+		return r.Redirects[0].Timing
+	}
+	return r.Timing
+}
+
+// FormatDuration formats a duration in milliseconds with 2 decimal places
+func FormatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(d.Nanoseconds())/1e6)
+}
+
+// TimingJSON represents timing information in JSON format
+type TimingJSON struct {
+	DNSLookup     string `json:"dns_lookup,omitempty"`
+	TCPConnection string `json:"tcp_connection,omitempty"`
+	TLSHandshake  string `json:"tls_handshake,omitempty"`
+	TTFB          string `json:"ttfb"`
+	TTLB          string `json:"ttlb"`
+	TotalTime     string `json:"total_time"`
+}
+
+// JSON converts the timing of a fully read response into its JSON
+// representation. Connection phases are omitted for reused connections.
+func (t Timing) JSON() TimingJSON {
+	timing := TimingJSON{
+		TTFB:      FormatDuration(t.ServerProcessing),
+		TTLB:      FormatDuration(t.ContentTransfer),
+		TotalTime: FormatDuration(t.Total),
+	}
+	if !t.ReusedConnection {
+		timing.DNSLookup = FormatDuration(t.DNSLookup)
+		timing.TCPConnection = FormatDuration(t.TCPConnection)
+		timing.TLSHandshake = FormatDuration(t.TLSHandshake)
+	}
+	return timing
+}
+
+// RequestJSON represents the request sent for a hop in JSON format
+type RequestJSON struct {
+	Method      string `json:"method"`
+	HeaderBytes int    `json:"header_bytes"`
+	BodySize    int64  `json:"body_size"`
+}
+
+// requestJSON converts request information into its JSON representation
+func requestJSON(request RequestInfo) RequestJSON {
+	return RequestJSON{
+		Method:      request.Method,
+		HeaderBytes: request.HeaderBytes,
+		BodySize:    request.BodySize,
+	}
+}
+
+// RedirectJSON represents a single redirect in JSON format
+type RedirectJSON struct {
+	URL        string               `json:"url"`
+	StatusCode int                  `json:"status_code"`
+	Status     string               `json:"status"`
+	Connection string               `json:"connection"`
+	Request    RequestJSON          `json:"request"`
+	DNS        *DNSJSON             `json:"dns,omitempty"`
+	Dial       *DialOverrideJSON    `json:"dial_override,omitempty"`
+	LocalAddr  string               `json:"local_addr,omitempty"`
+	RemoteAddr string               `json:"remote_addr,omitempty"`
+	Family     string               `json:"family,omitempty"`
+	Fallback   bool                 `json:"family_fallback,omitempty"`
+	Connects   []ConnectAttemptJSON `json:"connect_attempts,omitempty"`
+	TLS        *TLSJSON             `json:"tls,omitempty"`
+	Timing     TimingJSON           `json:"timing"`
+}
+
+// RedirectsJSON represents redirect information in JSON format
+type RedirectsJSON struct {
+	Count     int            `json:"count"`
+	TotalTime string         `json:"total_time"`
+	Chain     []RedirectJSON `json:"chain"`
+}
+
+// TotalTimesJSON represents total timing information in JSON format
+type TotalTimesJSON struct {
+	DNSLookups        string `json:"dns_lookups"`
+	TCPConnections    string `json:"tcp_connections"`
+	TLSHandshakes     string `json:"tls_handshakes"`
+	TotalResponseTime string `json:"total_response_time"`
+}
+
+// TraceJSON represents trace information in JSON format. Events carry the
+// structured trace, Messages is the same trace rendered for humans.
+type TraceJSON struct {
+	Events   []TraceEvent `json:"events"`
+	Messages []string     `json:"messages"`
+}
+
+// BrowserJSON represents browser page load milestones in JSON format
+type BrowserJSON struct {
+	DOMContentLoaded string `json:"dom_content_loaded"`
+	Load             string `json:"load"`
+	RedirectCount    int    `json:"redirect_count"`
+	RedirectTime     string `json:"redirect_time"`
+}
+
+// ResponseJSON represents the complete HTTP response information in JSON format
+type ResponseJSON struct {
+	URL          string               `json:"url"`
+	HTTPProtocol string               `json:"http_protocol"`
+	StatusCode   int                  `json:"status_code"`
+	Status       string               `json:"status"`
+	Connection   string               `json:"connection"`
+	Request      RequestJSON          `json:"request"`
+	DNS          *DNSJSON             `json:"dns,omitempty"`
+	Dial         *DialOverrideJSON    `json:"dial_override,omitempty"`
+	LocalAddr    string               `json:"local_addr,omitempty"`
+	RemoteAddr   string               `json:"remote_addr,omitempty"`
+	Family       string               `json:"family,omitempty"`
+	Fallback     bool                 `json:"family_fallback,omitempty"`
+	Connects     []ConnectAttemptJSON `json:"connect_attempts,omitempty"`
+	TLS          *TLSJSON             `json:"tls,omitempty"`
+	Timing       TimingJSON           `json:"timing"`
+	Redirects    RedirectsJSON        `json:"redirects,omitempty"`
+	Totals       TotalTimesJSON       `json:"totals"`
+	Browser      *BrowserJSON         `json:"browser,omitempty"`
+	CertCheck    *CertCheckJSON       `json:"cert_check,omitempty"`
+	Trace        TraceJSON            `json:"trace"`
+}
+
+// JSON converts the result into its JSON representation
+func (r *Result) JSON() ResponseJSON {
+	finalTiming := r.Timing
+	redirects := r.Redirects
+
+	result := ResponseJSON{
+		URL:          r.URL,
+		HTTPProtocol: r.HTTPProtocol,
+		StatusCode:   r.StatusCode,
+		Status:       r.Status,
+		Connection:   connectionInfo(finalTiming.ReusedConnection),
+		Request:      requestJSON(r.Request),
+		DNS:          r.DNS.JSON(),
+		Dial:         r.DialOverride.JSON(),
+		LocalAddr:    r.LocalAddr,
+		RemoteAddr:   r.RemoteAddr,
+		Family:       r.Family,
+		Fallback:     r.FamilyFallback,
+		Connects:     connectAttemptsJSON(r.Connects),
+		TLS:          r.TLS.JSON(),
+		Timing:       finalTiming.JSON(),
+		CertCheck:    r.CertCheck.JSON(),
+		Trace: TraceJSON{
+			Events:   r.TraceEvents,
+			Messages: FormatTrace(r.TraceEvents),
+		},
+	}
+
+	if r.Browser != nil {
+		result.Browser = &BrowserJSON{
+			DOMContentLoaded: FormatDuration(r.Browser.DOMContentLoaded),
+			Load:             FormatDuration(r.Browser.Load),
+			RedirectCount:    r.Browser.RedirectCount,
+			RedirectTime:     FormatDuration(r.Browser.Redirect),
+		}
+	}
+
+	// Calculate redirect information
+	if len(redirects) > 0 {
+		var totalRedirectTime time.Duration
+		redirectChain := make([]RedirectJSON, 0, len(redirects))
+
+		for _, redirect := range redirects {
+			totalRedirectTime += redirect.EndTime.Sub(redirect.StartTime)
+			redirectJSON := RedirectJSON{
+				URL:        redirect.URL,
+				StatusCode: redirect.StatusCode,
+				Status:     redirect.Status,
+				Connection: connectionInfo(redirect.Timing.ReusedConnection),
+				Request:    requestJSON(redirect.Request),
+				DNS:        redirect.DNS.JSON(),
+				Dial:       redirect.DialOverride.JSON(),
+				LocalAddr:  redirect.LocalAddr,
+				RemoteAddr: redirect.RemoteAddr,
+				Family:     redirect.Family,
+				Fallback:   redirect.FamilyFallback,
+				Connects:   connectAttemptsJSON(redirect.Connects),
+				TLS:        redirect.TLS.JSON(),
+				Timing: TimingJSON{
+					TTFB:      FormatDuration(redirect.Timing.ServerProcessing),
+					TotalTime: FormatDuration(redirect.EndTime.Sub(redirect.StartTime)),
+				},
+			}
+
+			if !redirect.Timing.ReusedConnection {
+				redirectJSON.Timing.DNSLookup = FormatDuration(redirect.Timing.DNSLookup)
+				redirectJSON.Timing.TCPConnection = FormatDuration(redirect.Timing.TCPConnection)
+				redirectJSON.Timing.TLSHandshake = FormatDuration(redirect.Timing.TLSHandshake)
+			}
+
+			redirectChain = append(redirectChain, redirectJSON)
+		}
+
+		result.Redirects = RedirectsJSON{
+			Count:     len(redirects),
+			TotalTime: FormatDuration(totalRedirectTime),
+			Chain:     redirectChain,
+		}
+	}
+
+	// Calculate total times
+	var totalDNS, totalTCP, totalTLS time.Duration
+	for _, redirect := range redirects {
+		if !redirect.Timing.ReusedConnection {
+			totalDNS += redirect.Timing.DNSLookup
+			totalTCP += redirect.Timing.TCPConnection
+			totalTLS += redirect.Timing.TLSHandshake
+		}
+	}
+	if !finalTiming.ReusedConnection {
+		totalDNS += finalTiming.DNSLookup
+		totalTCP += finalTiming.TCPConnection
+		totalTLS += finalTiming.TLSHandshake
+	}
+
+	totalResponseTime := r.TotalTime()
+	result.Totals = TotalTimesJSON{
+		DNSLookups:        FormatDuration(totalDNS),
+		TCPConnections:    FormatDuration(totalTCP),
+		TLSHandshakes:     FormatDuration(totalTLS),
+		TotalResponseTime: FormatDuration(totalResponseTime),
+	}
+
+	return result
+}
@@ -0,0 +1,270 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// resumeVersions are the TLS versions exercised by the resumption test
+var resumeVersions = []uint16{tls.VersionTLS12, tls.VersionTLS13}
+
+// ResumeAttempt is the outcome of the resumption test for one TLS version
+type ResumeAttempt struct {
+	Version         string
+	FullHandshake   time.Duration
+	ResumeHandshake time.Duration
+	TicketReceived  bool
+	TicketLifetime  time.Duration // TLS 1.2 lifetime hint, zero when unknown
+	Resumed         bool          // DidResume of the second connection
+	Error           string
+}
+
+// ResumeResult holds the resumption test results for every TLS version
+type ResumeResult struct {
+	URL      string
+	Addr     string
+	Attempts []ResumeAttempt
+}
+
+// ResumeTest checks whether the server resumes TLS sessions. For TLS 1.2
+// and 1.3, it performs a full handshake and a request to collect the
+// session ticket, drops the connection, then reconnects with the ticket.
+// Versions excluded by the TLS options are skipped.
+func (p *Probe) ResumeTest(ctx context.Context) (*ResumeResult, error) {
+	u, err := url.Parse(p.opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("TLS resumption test requires an https URL")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	result := &ResumeResult{URL: p.opts.URL, Addr: net.JoinHostPort(u.Hostname(), port)}
+	for _, version := range resumeVersions {
+		if (p.opts.TLS.MinVersion != 0 && version < p.opts.TLS.MinVersion) ||
+			(p.opts.TLS.MaxVersion != 0 && version > p.opts.TLS.MaxVersion) {
+			continue
+		}
+		result.Attempts = append(result.Attempts, p.resumeAttempt(ctx, u, result.Addr, version))
+	}
+	return result, nil
+}
+
+// resumeAttempt runs the resumption test for a single TLS version
+func (p *Probe) resumeAttempt(ctx context.Context, u *url.URL, addr string, version uint16) ResumeAttempt {
+	attempt := ResumeAttempt{Version: tls.VersionName(version)}
+
+	cache := &recordingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	config := newTLSConfig(p.opts.TLS, 0, 0)
+	config.MinVersion = version
+	config.MaxVersion = version
+	config.ClientSessionCache = cache
+	config.NextProtos = []string{"http/1.1"}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+
+	// The first connection does a full handshake and reads a response, as
+	// TLS 1.3 tickets only arrive after the handshake
+	conn, elapsed, lifetimeHint, err := p.resumeHandshake(ctx, addr, config)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("full handshake failed: %v", err)
+		return attempt
+	}
+	attempt.FullHandshake = elapsed
+	err = resumeRequest(conn, u)
+	conn.Close()
+	if err != nil {
+		attempt.Error = fmt.Sprintf("request failed: %v", err)
+		return attempt
+	}
+
+	// TLS 1.3 tickets arrive encrypted and crypto/tls does not expose their
+	// lifetime, so only the TLS 1.2 hint sent in the clear is known
+	attempt.TicketReceived = cache.last() != nil
+	if version == tls.VersionTLS12 {
+		attempt.TicketLifetime = lifetimeHint
+	}
+
+	conn, elapsed, _, err = p.resumeHandshake(ctx, addr, config)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("resumed handshake failed: %v", err)
+		return attempt
+	}
+	attempt.ResumeHandshake = elapsed
+	attempt.Resumed = conn.ConnectionState().DidResume
+	conn.Close()
+	return attempt
+}
+
+// resumeHandshake dials addr and times the TLS handshake. It also returns
+// the lifetime hint of a TLS 1.2 session ticket, which is sent in the clear.
+func (p *Probe) resumeHandshake(ctx context.Context, addr string, config *tls.Config) (*tls.Conn, time.Duration, time.Duration, error) {
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+
+	raw, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	sniffer := &ticketSniffer{Conn: raw}
+	conn := tls.Client(sniffer, config)
+
+	start := time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, 0, 0, err
+	}
+	elapsed := time.Since(start)
+	return conn, elapsed, sniffer.lifetimeHint(), nil
+}
+
+// resumeRequest sends a HEAD request over conn and reads the response
+func resumeRequest(conn *tls.Conn, u *url.URL) error {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Close = true
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// recordingSessionCache remembers the last session stored in it
+type recordingSessionCache struct {
+	tls.ClientSessionCache
+	mu      sync.Mutex
+	session *tls.ClientSessionState
+}
+
+func (c *recordingSessionCache) Put(key string, cs *tls.ClientSessionState) {
+	c.mu.Lock()
+	if cs != nil {
+		c.session = cs
+	}
+	c.mu.Unlock()
+	c.ClientSessionCache.Put(key, cs)
+}
+
+// last returns the last session stored, if any
+func (c *recordingSessionCache) last() *tls.ClientSessionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// maxSniffedBytes bounds how much of the server's handshake is kept
+const maxSniffedBytes = 256 << 10
+
+// ticketSniffer keeps the first bytes the server sends, so the plaintext
+// TLS 1.2 NewSessionTicket message can be found after the handshake
+type ticketSniffer struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *ticketSniffer) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if len(c.buf) < maxSniffedBytes {
+		c.buf = append(c.buf, b[:n]...)
+	}
+	return n, err
+}
+
+// lifetimeHint returns the lifetime hint of a NewSessionTicket message sent
+// before the server's ChangeCipherSpec, or zero if there is none
+func (c *ticketSniffer) lifetimeHint() time.Duration {
+	// Join the handshake records up to ChangeCipherSpec
+	var handshake []byte
+	data := c.buf
+	for len(data) >= 5 {
+		recordType, length := data[0], int(binary.BigEndian.Uint16(data[3:5]))
+		if recordType == 20 || len(data) < 5+length {
+			break
+		}
+		if recordType == 22 {
+			handshake = append(handshake, data[5:5+length]...)
+		}
+		data = data[5+length:]
+	}
+
+	for len(handshake) >= 4 {
+		msgType := handshake[0]
+		length := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+		if len(handshake) < 4+length {
+			break
+		}
+		// The length check above guarantees the 4 bytes of the hint are there
+		if msgType == 4 && length >= 4 {
+			return time.Duration(binary.BigEndian.Uint32(handshake[4:8])) * time.Second
+		}
+		handshake = handshake[4+length:]
+	}
+	return 0
+}
+
+// ResumeAttemptJSON represents a resumption test attempt in JSON format
+type ResumeAttemptJSON struct {
+	Version         string `json:"version"`
+	FullHandshake   string `json:"full_handshake,omitempty"`
+	ResumeHandshake string `json:"resume_handshake,omitempty"`
+	TicketReceived  bool   `json:"ticket_received"`
+	TicketLifetime  string `json:"ticket_lifetime,omitempty"`
+	Resumed         bool   `json:"resumed"`
+	Error           string `json:"error,omitempty"`
+}
+
+// ResumeJSON represents the resumption test in JSON format
+type ResumeJSON struct {
+	URL      string              `json:"url"`
+	Addr     string              `json:"addr"`
+	Attempts []ResumeAttemptJSON `json:"attempts"`
+}
+
+// JSON converts the resumption test into its JSON representation
+func (r *ResumeResult) JSON() ResumeJSON {
+	result := ResumeJSON{URL: r.URL, Addr: r.Addr, Attempts: make([]ResumeAttemptJSON, 0, len(r.Attempts))}
+	for _, attempt := range r.Attempts {
+		a := ResumeAttemptJSON{
+			Version:        attempt.Version,
+			TicketReceived: attempt.TicketReceived,
+			Resumed:        attempt.Resumed,
+			Error:          attempt.Error,
+		}
+		if attempt.FullHandshake > 0 {
+			a.FullHandshake = FormatDuration(attempt.FullHandshake)
+		}
+		if attempt.ResumeHandshake > 0 {
+			a.ResumeHandshake = FormatDuration(attempt.ResumeHandshake)
+		}
+		if attempt.TicketLifetime > 0 {
+			a.TicketLifetime = attempt.TicketLifetime.String()
+		} else if attempt.TicketReceived {
+			a.TicketLifetime = "unknown"
+		}
+		result.Attempts = append(result.Attempts, a)
+	}
+	return result
+}
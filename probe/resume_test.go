@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// tlsRecord frames payload as a TLS 1.2 record of the given content type
+func tlsRecord(contentType byte, payload []byte) []byte {
+	record := []byte{contentType, 3, 3, 0, 0}
+	binary.BigEndian.PutUint16(record[3:], uint16(len(payload)))
+	return append(record, payload...)
+}
+
+// handshakeMessage frames body as a handshake message of the given type
+func handshakeMessage(msgType byte, body []byte) []byte {
+	n := len(body)
+	return append([]byte{msgType, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+}
+
+// newSessionTicket is a NewSessionTicket message with a lifetime hint in
+// seconds and a short ticket
+func newSessionTicket(hint uint32) []byte {
+	body := binary.BigEndian.AppendUint32(nil, hint)
+	body = append(body, 0, 4, 't', 'k', 't', '!')
+	return handshakeMessage(4, body)
+}
+
+// readerConn is a connection that reads from r
+type readerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readerConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func TestTicketSnifferLifetimeHint(t *testing.T) {
+	serverHello := handshakeMessage(2, bytes.Repeat([]byte{1}, 70))
+	certificate := handshakeMessage(11, bytes.Repeat([]byte{2}, 300))
+	helloDone := handshakeMessage(14, nil)
+	ticket := newSessionTicket(7200)
+	changeCipherSpec := tlsRecord(20, []byte{1})
+
+	concat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name   string
+		flight []byte
+		want   time.Duration
+	}{
+		{
+			name: "ticket in its own record",
+			flight: concat(tlsRecord(22, concat(serverHello, certificate, helloDone)),
+				tlsRecord(22, ticket), changeCipherSpec),
+			want: 2 * time.Hour,
+		},
+		{
+			name: "ticket split across records",
+			flight: concat(tlsRecord(22, concat(serverHello, certificate, helloDone, ticket[:3])),
+				tlsRecord(22, ticket[3:7]), tlsRecord(22, ticket[7:]), changeCipherSpec),
+			want: 2 * time.Hour,
+		},
+		{
+			name:   "message split across records",
+			flight: concat(tlsRecord(22, certificate[:100]), tlsRecord(22, concat(certificate[100:], ticket)), changeCipherSpec),
+			want:   2 * time.Hour,
+		},
+		{
+			name:   "no ticket",
+			flight: concat(tlsRecord(22, concat(serverHello, certificate, helloDone)), changeCipherSpec),
+		},
+		{
+			name:   "truncated record",
+			flight: tlsRecord(22, concat(serverHello, ticket))[:5+len(serverHello)+6],
+		},
+		{
+			name:   "truncated record after the ticket's record",
+			flight: concat(tlsRecord(22, ticket), tlsRecord(22, certificate)[:20]),
+			want:   2 * time.Hour,
+		},
+		{
+			name:   "truncated message",
+			flight: concat(tlsRecord(22, concat(serverHello, ticket[:6])), changeCipherSpec),
+		},
+		{
+			// Handshake records after ChangeCipherSpec are encrypted
+			name: "ticket after ChangeCipherSpec",
+			flight: concat(tlsRecord(22, concat(serverHello, certificate, helloDone)), changeCipherSpec,
+				tlsRecord(22, newSessionTicket(60))),
+		},
+		{
+			name:   "ticket too short for a hint",
+			flight: concat(tlsRecord(22, handshakeMessage(4, []byte{0, 0, 1})), changeCipherSpec),
+		},
+		{
+			name:   "records of other types are skipped",
+			flight: concat(tlsRecord(21, []byte{1, 0}), tlsRecord(22, ticket), changeCipherSpec),
+			want:   2 * time.Hour,
+		},
+		{name: "nothing read"},
+	}
+
+	for _, tt := range tests {
+		// Read a byte at a time to check the sniffer joins its reads
+		sniffer := &ticketSniffer{Conn: readerConn{r: iotest.OneByteReader(bytes.NewReader(tt.flight))}}
+		if _, err := io.Copy(io.Discard, sniffer); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sniffer.buf, tt.flight) {
+			t.Errorf("%s: sniffed %d bytes, want %d", tt.name, len(sniffer.buf), len(tt.flight))
+		}
+		if got := sniffer.lifetimeHint(); got != tt.want {
+			t.Errorf("%s: lifetimeHint = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// scanVersions are the TLS versions enumerated by a scan, oldest first
+var scanVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+// scanCurves are the key exchange groups enumerated by a scan
+var scanCurves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521, tls.X25519MLKEM768}
+
+// defaultScanTimeout bounds each handshake when the probe has no timeout
+const defaultScanTimeout = 10 * time.Second
+
+// ScanAttempt is a single handshake attempted by a TLS scan
+type ScanAttempt struct {
+	Version     string
+	CipherSuite string // Negotiated cipher suite, or the one offered if rejected
+	Curve       string // Offered key exchange group, empty for the defaults
+	Accepted    bool
+	Handshake   time.Duration
+	Error       string
+}
+
+// ScanResult holds the handshakes attempted by a TLS scan. Versions has one
+// attempt per TLS version offering every suite, CipherSuites one per
+// version and suite, and Curves one per version and key exchange group.
+type ScanResult struct {
+	URL          string
+	Addr         string
+	Versions     []ScanAttempt
+	CipherSuites []ScanAttempt
+	Curves       []ScanAttempt
+}
+
+// TLSScan enumerates the TLS versions, cipher suites and key exchange
+// groups the server accepts, using the probe's dialer and resolver. The
+// server's certificate is not verified, so every combination can be tried.
+// TLS 1.3 suites cannot be chosen by the client, so only the one the server
+// negotiates is reported for TLS 1.3.
+func (p *Probe) TLSScan(ctx context.Context) (*ScanResult, error) {
+	u, err := url.Parse(p.opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("TLS scan requires an https URL")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	scan := &ScanResult{URL: p.opts.URL, Addr: net.JoinHostPort(u.Hostname(), port)}
+	serverName := p.opts.TLS.ServerName
+	if serverName == "" {
+		serverName = u.Hostname()
+	}
+	attempt := func(version uint16, suites []uint16, curve tls.CurveID) ScanAttempt {
+		config := &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			Certificates:       p.opts.TLS.Certificates,
+			MinVersion:         version,
+			MaxVersion:         version,
+			CipherSuites:       suites,
+		}
+		if curve != 0 {
+			config.CurvePreferences = []tls.CurveID{curve}
+		}
+		return p.scanHandshake(ctx, scan.Addr, config)
+	}
+
+	for _, version := range scanVersions {
+		// Offer every suite, as Go leaves the insecure ones out by default
+		result := attempt(version, suitesFor(version), 0)
+		scan.Versions = append(scan.Versions, result)
+
+		// Suites and groups of a version the server rejects outright are
+		// reported without another round of handshakes
+		skip := func(a ScanAttempt) ScanAttempt {
+			if !result.Accepted {
+				a.Error = "version not accepted"
+			}
+			return a
+		}
+
+		if version == tls.VersionTLS13 {
+			if result.Accepted {
+				scan.CipherSuites = append(scan.CipherSuites, result)
+			}
+		} else {
+			for _, suite := range suitesFor(version) {
+				a := ScanAttempt{Version: tls.VersionName(version), CipherSuite: tls.CipherSuiteName(suite)}
+				if result.Accepted {
+					a = attempt(version, []uint16{suite}, 0)
+					if !a.Accepted {
+						a.CipherSuite = tls.CipherSuiteName(suite)
+					}
+				}
+				scan.CipherSuites = append(scan.CipherSuites, skip(a))
+			}
+		}
+
+		for _, curve := range scanCurves {
+			if curve == tls.X25519MLKEM768 && version < tls.VersionTLS13 {
+				continue
+			}
+			a := ScanAttempt{Version: tls.VersionName(version)}
+			if result.Accepted {
+				var suites []uint16
+				if version < tls.VersionTLS13 {
+					suites = ecdheSuitesFor(version)
+				}
+				a = attempt(version, suites, curve)
+			}
+			a.Curve = curve.String()
+			scan.Curves = append(scan.Curves, skip(a))
+		}
+	}
+	return scan, nil
+}
+
+// scanHandshake dials addr and attempts a single handshake with config
+func (p *Probe) scanHandshake(ctx context.Context, addr string, config *tls.Config) ScanAttempt {
+	attempt := ScanAttempt{Version: tls.VersionName(config.MinVersion)}
+	timeout := p.opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	raw, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("connect failed: %v", err)
+		return attempt
+	}
+	conn := tls.Client(raw, config)
+	defer conn.Close()
+
+	start := time.Now()
+	err = conn.HandshakeContext(ctx)
+	attempt.Handshake = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	attempt.Accepted = true
+	attempt.CipherSuite = tls.CipherSuiteName(conn.ConnectionState().CipherSuite)
+	return attempt
+}
+
+// suitesFor returns the cipher suites, secure and insecure, usable with a
+// TLS 1.0-1.2 version. TLS 1.3 suites are not configurable, so it returns
+// nil for TLS 1.3.
+func suitesFor(version uint16) []uint16 {
+	var ids []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, v := range suite.SupportedVersions {
+			if v == version && version < tls.VersionTLS13 {
+				ids = append(ids, suite.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// ecdheSuitesFor returns the ECDHE suites usable with version, so that a
+// successful handshake proves the offered group was used
+func ecdheSuitesFor(version uint16) []uint16 {
+	var ids []uint16
+	for _, id := range suitesFor(version) {
+		if strings.HasPrefix(tls.CipherSuiteName(id), "TLS_ECDHE_") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ScanCellJSON represents one handshake of a TLS scan in JSON format
+type ScanCellJSON struct {
+	Accepted    bool   `json:"accepted"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	Handshake   string `json:"handshake,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ScanRowJSON is one row of the scan matrix, with a cell per TLS version
+// the row applies to
+type ScanRowJSON struct {
+	Name     string                   `json:"name"`
+	Versions map[string]*ScanCellJSON `json:"versions"`
+}
+
+// ScanJSON represents a TLS scan in JSON format
+type ScanJSON struct {
+	URL          string                   `json:"url"`
+	Addr         string                   `json:"addr"`
+	Versions     map[string]*ScanCellJSON `json:"versions"`
+	CipherSuites []ScanRowJSON            `json:"cipher_suites"`
+	Curves       []ScanRowJSON            `json:"curves"`
+}
+
+// cellJSON converts a scan attempt into a matrix cell
+func (a ScanAttempt) cellJSON() *ScanCellJSON {
+	cell := &ScanCellJSON{Accepted: a.Accepted, Error: a.Error}
+	if a.Accepted {
+		cell.CipherSuite = a.CipherSuite
+	}
+	if a.Handshake > 0 {
+		cell.Handshake = FormatDuration(a.Handshake)
+	}
+	return cell
+}
+
+// scanRows groups attempts into rows named by key, in order of appearance
+func scanRows(attempts []ScanAttempt, key func(ScanAttempt) string) []ScanRowJSON {
+	var rows []ScanRowJSON
+	index := make(map[string]int)
+	for _, a := range attempts {
+		name := key(a)
+		i, ok := index[name]
+		if !ok {
+			i = len(rows)
+			index[name] = i
+			rows = append(rows, ScanRowJSON{Name: name, Versions: make(map[string]*ScanCellJSON)})
+		}
+		rows[i].Versions[a.Version] = a.cellJSON()
+	}
+	return rows
+}
+
+// JSON converts the scan into its JSON matrix representation
+func (r *ScanResult) JSON() ScanJSON {
+	result := ScanJSON{
+		URL:          r.URL,
+		Addr:         r.Addr,
+		Versions:     make(map[string]*ScanCellJSON, len(r.Versions)),
+		CipherSuites: scanRows(r.CipherSuites, func(a ScanAttempt) string { return a.CipherSuite }),
+		Curves:       scanRows(r.Curves, func(a ScanAttempt) string { return a.Curve }),
+	}
+	for _, a := range r.Versions {
+		result.Versions[a.Version] = a.cellJSON()
+	}
+	return result
+}
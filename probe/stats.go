@@ -0,0 +1,150 @@
+package probe
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PhaseStats summarizes the latency of one phase across many samples
+type PhaseStats struct {
+	Samples int
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	StdDev  time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+}
+
+// Stats summarizes per-phase latency across repeated probes. DNS, TCP and
+// TLS only count samples that opened a new connection, since reused
+// connections skip those phases entirely.
+type Stats struct {
+	Samples           int
+	ReusedConnections int
+	DNSLookup         PhaseStats
+	TCPConnection     PhaseStats
+	TLSHandshake      PhaseStats
+	TTFB              PhaseStats
+	TTLB              PhaseStats
+}
+
+// ComputeStats computes per-phase statistics from the given timings
+func ComputeStats(timings []Timing) Stats {
+	var dns, tcp, tlsHandshake, ttfb, ttlb []time.Duration
+	stats := Stats{Samples: len(timings)}
+
+	for _, t := range timings {
+		if t.ReusedConnection {
+			stats.ReusedConnections++
+		} else {
+			dns = append(dns, t.DNSLookup)
+			tcp = append(tcp, t.TCPConnection)
+			tlsHandshake = append(tlsHandshake, t.TLSHandshake)
+		}
+		ttfb = append(ttfb, t.ServerProcessing)
+		ttlb = append(ttlb, t.ContentTransfer)
+	}
+
+	stats.DNSLookup = computePhaseStats(dns)
+	stats.TCPConnection = computePhaseStats(tcp)
+	stats.TLSHandshake = computePhaseStats(tlsHandshake)
+	stats.TTFB = computePhaseStats(ttfb)
+	stats.TTLB = computePhaseStats(ttlb)
+	return stats
+}
+
+// computePhaseStats computes min/max/mean/stddev and percentiles of samples
+func computePhaseStats(samples []time.Duration) PhaseStats {
+	if len(samples) == 0 {
+		return PhaseStats{}
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(sorted))
+
+	var variance float64
+	for _, d := range sorted {
+		diff := float64(d) - mean
+		variance += diff * diff
+	}
+	variance /= float64(len(sorted))
+
+	return PhaseStats{
+		Samples: len(sorted),
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		Mean:    time.Duration(mean),
+		StdDev:  time.Duration(math.Sqrt(variance)),
+		P50:     percentile(sorted, 50),
+		P90:     percentile(sorted, 90),
+		P99:     percentile(sorted, 99),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of an ascending slice
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// PhaseStatsJSON represents phase statistics in JSON format
+type PhaseStatsJSON struct {
+	Samples int    `json:"samples"`
+	Min     string `json:"min"`
+	Max     string `json:"max"`
+	Mean    string `json:"mean"`
+	StdDev  string `json:"stddev"`
+	P50     string `json:"p50"`
+	P90     string `json:"p90"`
+	P99     string `json:"p99"`
+}
+
+// StatsJSON represents latency statistics in JSON format
+type StatsJSON struct {
+	Samples           int            `json:"samples"`
+	ReusedConnections int            `json:"reused_connections"`
+	DNSLookup         PhaseStatsJSON `json:"dns_lookup"`
+	TCPConnection     PhaseStatsJSON `json:"tcp_connection"`
+	TLSHandshake      PhaseStatsJSON `json:"tls_handshake"`
+	TTFB              PhaseStatsJSON `json:"ttfb"`
+	TTLB              PhaseStatsJSON `json:"ttlb"`
+}
+
+// JSON converts the phase statistics into their JSON representation
+func (s PhaseStats) JSON() PhaseStatsJSON {
+	return PhaseStatsJSON{
+		Samples: s.Samples,
+		Min:     FormatDuration(s.Min),
+		Max:     FormatDuration(s.Max),
+		Mean:    FormatDuration(s.Mean),
+		StdDev:  FormatDuration(s.StdDev),
+		P50:     FormatDuration(s.P50),
+		P90:     FormatDuration(s.P90),
+		P99:     FormatDuration(s.P99),
+	}
+}
+
+// JSON converts the statistics into their JSON representation
+func (s Stats) JSON() StatsJSON {
+	return StatsJSON{
+		Samples:           s.Samples,
+		ReusedConnections: s.ReusedConnections,
+		DNSLookup:         s.DNSLookup.JSON(),
+		TCPConnection:     s.TCPConnection.JSON(),
+		TLSHandshake:      s.TLSHandshake.JSON(),
+		TTFB:              s.TTFB.JSON(),
+		TTLB:              s.TTLB.JSON(),
+	}
+}
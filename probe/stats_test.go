@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// millis returns durations of the given milliseconds
+func millis(ms ...int) []time.Duration {
+	durations := make([]time.Duration, 0, len(ms))
+	for _, m := range ms {
+		durations = append(durations, time.Duration(m)*time.Millisecond)
+	}
+	return durations
+}
+
+// rangeMillis returns 1ms, 2ms, ... nms in a shuffled order
+func rangeMillis(n int) []time.Duration {
+	durations := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		// Stride through the range so the input is not already sorted
+		durations = append(durations, time.Duration((i*7)%n+1)*time.Millisecond)
+	}
+	return durations
+}
+
+func TestComputePhaseStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    PhaseStats
+	}{
+		{
+			name: "no samples",
+			want: PhaseStats{},
+		},
+		{
+			name:    "one sample",
+			samples: millis(5),
+			want: PhaseStats{
+				Samples: 1,
+				Min:     5 * time.Millisecond, Max: 5 * time.Millisecond, Mean: 5 * time.Millisecond,
+				P50: 5 * time.Millisecond, P90: 5 * time.Millisecond, P99: 5 * time.Millisecond,
+			},
+		},
+		{
+			name:    "even number of samples",
+			samples: millis(40, 10, 30, 20),
+			want: PhaseStats{
+				Samples: 4,
+				Min:     10 * time.Millisecond, Max: 40 * time.Millisecond, Mean: 25 * time.Millisecond,
+				StdDev: time.Duration(11180339), // sqrt(125) ms
+				P50:    20 * time.Millisecond, P90: 40 * time.Millisecond, P99: 40 * time.Millisecond,
+			},
+		},
+		{
+			name:    "ten samples",
+			samples: rangeMillis(10),
+			want: PhaseStats{
+				Samples: 10,
+				Min:     1 * time.Millisecond, Max: 10 * time.Millisecond, Mean: 5500 * time.Microsecond,
+				StdDev: time.Duration(2872281), // sqrt(8.25) ms
+				P50:    5 * time.Millisecond, P90: 9 * time.Millisecond, P99: 10 * time.Millisecond,
+			},
+		},
+		{
+			name:    "hundred samples",
+			samples: rangeMillis(100),
+			want: PhaseStats{
+				Samples: 100,
+				Min:     1 * time.Millisecond, Max: 100 * time.Millisecond, Mean: 50500 * time.Microsecond,
+				StdDev: time.Duration(28866070), // sqrt(833.25) ms
+				P50:    50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computePhaseStats(tt.samples)
+			if got != tt.want {
+				t.Errorf("computePhaseStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentileBoundaries(t *testing.T) {
+	sorted := millis(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{5, 1 * time.Millisecond},
+		{5.1, 2 * time.Millisecond},
+		{50, 10 * time.Millisecond},
+		{50.1, 11 * time.Millisecond},
+		{90, 18 * time.Millisecond},
+		{95, 19 * time.Millisecond},
+		{99, 20 * time.Millisecond},
+		{100, 20 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(p%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestComputeStatsReusedConnections(t *testing.T) {
+	timings := []Timing{
+		{DNSLookup: 3 * time.Millisecond, TCPConnection: 5 * time.Millisecond, ServerProcessing: 10 * time.Millisecond},
+		{ReusedConnection: true, ServerProcessing: 20 * time.Millisecond},
+		{ReusedConnection: true, ServerProcessing: 30 * time.Millisecond},
+	}
+
+	stats := ComputeStats(timings)
+	if stats.Samples != 3 {
+		t.Errorf("Samples = %d, want 3", stats.Samples)
+	}
+	if stats.ReusedConnections != 2 {
+		t.Errorf("ReusedConnections = %d, want 2", stats.ReusedConnections)
+	}
+	// Reused connections skip DNS, TCP and TLS, so only one sample counts
+	if stats.DNSLookup.Samples != 1 || stats.TCPConnection.Samples != 1 || stats.TLSHandshake.Samples != 1 {
+		t.Errorf("connection phase samples = %d/%d/%d, want 1/1/1",
+			stats.DNSLookup.Samples, stats.TCPConnection.Samples, stats.TLSHandshake.Samples)
+	}
+	if stats.TCPConnection.Max != 5*time.Millisecond {
+		t.Errorf("TCPConnection.Max = %v, want 5ms", stats.TCPConnection.Max)
+	}
+	if stats.TTFB.Samples != 3 || stats.TTFB.P50 != 20*time.Millisecond {
+		t.Errorf("TTFB = %+v, want 3 samples with p50 20ms", stats.TTFB)
+	}
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	stats := ComputeStats(nil)
+	if stats != (Stats{}) {
+		t.Errorf("ComputeStats(nil) = %+v, want zero stats", stats)
+	}
+}
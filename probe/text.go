@@ -0,0 +1,676 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ANSI escape sequences used by the text renderer
+const (
+	ansiReset   = "\x1b[0m"
+	ansiGray    = "\x1b[90m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// waterfallWidth is the number of columns used for the redirect waterfall
+const waterfallWidth = 40
+
+// textPhase describes how a phase is drawn in the waterfall
+type textPhase struct {
+	name   string
+	color  string
+	symbol string // Used instead of color when color is disabled
+}
+
+var textPhases = []textPhase{
+	{"DNS Lookup", ansiCyan, "d"},
+	{"TCP Connection", ansiYellow, "c"},
+	{"TLS Handshake", ansiMagenta, "t"},
+	{"Server Processing", ansiGreen, "w"},
+	{"Content Transfer", ansiBlue, "r"},
+}
+
+// textWriter writes text output, optionally colored
+type textWriter struct {
+	w     io.Writer
+	color bool
+	err   error
+}
+
+func (t *textWriter) printf(format string, args ...interface{}) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintf(t.w, format, args...)
+	}
+}
+
+// paint wraps s in the given color when color output is enabled
+func (t *textWriter) paint(color, s string) string {
+	if !t.color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// formatMillis formats a duration as whole milliseconds, like httpstat
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// hopPhases splits a hop's timing into the sequential waterfall phases.
+// ServerProcessing is measured from the start of the hop, so the time spent
+// connecting is subtracted to get the server's share.
+func hopPhases(t Timing) [5]time.Duration {
+	connecting := t.DNSLookup + t.TCPConnection + t.TLSHandshake
+	wait := t.ServerProcessing - connecting
+	if wait < 0 {
+		wait = 0
+	}
+	return [5]time.Duration{t.DNSLookup, t.TCPConnection, t.TLSHandshake, wait, t.ContentTransfer}
+}
+
+// WriteText renders the result as httpstat-style phase boxes followed by a
+// waterfall of the redirect chain
+func (r *Result) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+
+	t.printf("%s %s\n", t.paint(ansiGreen, r.HTTPProtocol), t.paint(ansiCyan, r.Status))
+	t.printf("%s %s\n", t.paint(ansiGray, "URL:"), r.URL)
+	connection := connectionInfo(r.Timing.ReusedConnection)
+	if r.Family != "" {
+		connection += " over " + r.Family
+	}
+	if r.FamilyFallback {
+		connection += " " + t.paint(ansiYellow, "(fallback)")
+	}
+	if r.RemoteAddr != "" {
+		connection += ", " + r.LocalAddr + " -> " + r.RemoteAddr
+	}
+	t.printf("%s %s\n", t.paint(ansiGray, "Connection:"), connection)
+	if r.DialOverride != nil {
+		t.writeDialOverride(r.DialOverride)
+	}
+	if r.DNS != nil {
+		t.writeDNS(r.DNS)
+	}
+	if len(r.Connects) > 1 {
+		t.writeConnects(r.Connects)
+	}
+	if r.TLS != nil {
+		t.writeTLS(r.TLS)
+	}
+	if r.CertCheck != nil {
+		t.writeCertCheck(r.CertCheck)
+	}
+	t.writeBoxes(r.Timing, strings.HasPrefix(r.URL, "https://"))
+
+	if r.Browser != nil {
+		t.printf("\n%s %s  %s %s\n", t.paint(ansiGray, "DOMContentLoaded:"), t.paint(ansiCyan, formatMillis(r.Browser.DOMContentLoaded)),
+			t.paint(ansiGray, "Load:"), t.paint(ansiCyan, formatMillis(r.Browser.Load)))
+		if r.Browser.RedirectCount > 0 {
+			t.printf("%s %d (%s)\n", t.paint(ansiGray, "Redirects:"), r.Browser.RedirectCount, formatMillis(r.Browser.Redirect))
+		}
+	}
+
+	if len(r.Redirects) > 0 {
+		t.writeWaterfall(r)
+	}
+	return t.err
+}
+
+// writeDialOverride prints where -connect-to and -resolve rules sent the
+// connection
+func (t *textWriter) writeDialOverride(o *DialOverride) {
+	route := []string{o.Address}
+	if o.ConnectTo != "" {
+		route = append(route, o.ConnectTo)
+	}
+	if len(o.Resolve) > 0 {
+		route = append(route, strings.Join(o.Resolve, ", "))
+	}
+	t.printf("%s %s\n", t.paint(ansiGray, "Route:"), strings.Join(route, " -> "))
+}
+
+// writeDNS prints the resolved addresses and the custom resolver's queries
+func (t *textWriter) writeDNS(info *DNSInfo) {
+	answer := strings.Join(info.Addrs, ", ")
+	if info.Error != "" {
+		answer = t.paint(ansiMagenta, info.Error)
+	}
+	var details []string
+	if info.Coalesced {
+		details = append(details, "coalesced")
+	}
+	if len(info.Servers) > 0 {
+		details = append(details, "via "+strings.Join(info.Servers, ", "))
+	}
+	if len(details) > 0 {
+		answer += " (" + strings.Join(details, ", ") + ")"
+	}
+	t.printf("%s %s -> %s\n", t.paint(ansiGray, "DNS:"), info.Host, answer)
+	for _, q := range info.Queries {
+		server := q.Server
+		if !strings.HasPrefix(server, q.Network+"://") {
+			server += " over " + q.Network
+		}
+		if q.Error != "" {
+			server += " " + t.paint(ansiMagenta, q.Error)
+		}
+		t.printf("  %-5s %9s  %s\n", q.Type, FormatDuration(q.Duration), server)
+	}
+}
+
+// writeConnects prints the attempts of a Happy Eyeballs race, marking the
+// one whose connection was used
+func (t *textWriter) writeConnects(attempts []ConnectAttempt) {
+	t.printf("%s\n", t.paint(ansiGray, "Connect attempts:"))
+	for _, a := range attempts {
+		outcome := t.paint(ansiGray, "lost")
+		if a.Error != "" {
+			outcome = t.paint(ansiMagenta, a.Error)
+		} else if a.Winner {
+			outcome = t.paint(ansiGreen, "winner")
+		}
+		t.printf("  %-4s %9s %9s  %s  %s\n", a.Family, formatDelta(a.Start), FormatDuration(a.Duration), a.Addr, outcome)
+	}
+}
+
+// writeTLS prints the negotiated TLS parameters and the leaf certificate
+func (t *textWriter) writeTLS(info *TLSInfo) {
+	details := []string{info.Version, info.CipherSuite}
+	if info.ALPN != "" {
+		details = append(details, "ALPN "+info.ALPN)
+	}
+	if info.Resumed {
+		details = append(details, "resumed")
+	}
+	if info.OCSPStapled {
+		details = append(details, "OCSP stapled")
+	}
+	t.printf("%s %s\n", t.paint(ansiGray, "TLS:"), strings.Join(details, ", "))
+	if info.Pin != nil {
+		chain := ""
+		if info.Pin.Chain > 0 {
+			chain = fmt.Sprintf(" of verified chain %d", info.Pin.Chain)
+		}
+		t.printf("%s matched at chain position %d%s (%s)\n", t.paint(ansiGray, "Pin:"), info.Pin.Position, chain, info.Pin.Subject)
+	}
+	if len(info.Certificates) > 0 {
+		leaf := info.Certificates[0]
+		t.printf("%s %s, expires in %d days (%s)\n", t.paint(ansiGray, "Certificate:"), leaf.Subject,
+			leaf.DaysToExpiry, leaf.NotAfter.Format("2006-01-02"))
+	}
+}
+
+// writeCertCheck prints the certificate check status and its issues
+func (t *textWriter) writeCertCheck(c *CertCheck) {
+	colors := map[string]string{SeverityOK: ansiGreen, SeverityWarning: ansiYellow, SeverityCritical: ansiMagenta}
+	t.printf("%s %s\n", t.paint(ansiGray, "Certificate check:"), t.paint(colors[c.Status], strings.ToUpper(c.Status)))
+	for _, issue := range c.Issues {
+		t.printf("  %s %s: %s (%s)\n", t.paint(colors[issue.Severity], strings.ToUpper(issue.Severity)), issue.Check, issue.Message, issue.URL)
+	}
+}
+
+// writeBoxes draws the classic httpstat phase boxes for the final hop
+func (t *textWriter) writeBoxes(timing Timing, https bool) {
+	phases := hopPhases(timing)
+	a := func(i int) string { return t.paint(ansiCyan, centre(formatMillis(phases[i]), 7)) }
+	b := func(d time.Duration) string { return t.paint(ansiCyan, fmt.Sprintf("%-7s", formatMillis(d))) }
+
+	nameLookup := phases[0]
+	connect := nameLookup + phases[1]
+	preTransfer := connect + phases[2]
+	startTransfer := preTransfer + phases[3]
+	total := startTransfer + phases[4]
+
+	if https {
+		t.printf("\n  DNS Lookup   TCP Connection   TLS Handshake   Server Processing   Content Transfer\n")
+		t.printf("[   %s  |     %s    |    %s    |      %s      |      %s     ]\n", a(0), a(1), a(2), a(3), a(4))
+		t.printf("             |                |               |                   |                  |\n")
+		t.printf("    namelookup:%s        |               |                   |                  |\n", b(nameLookup))
+		t.printf("                        connect:%s       |                   |                  |\n", b(connect))
+		t.printf("                                    pretransfer:%s           |                  |\n", b(preTransfer))
+		t.printf("                                                      starttransfer:%s          |\n", b(startTransfer))
+		t.printf("                                                                                 total:%s\n", t.paint(ansiCyan, formatMillis(total)))
+		return
+	}
+
+	t.printf("\n  DNS Lookup   TCP Connection   Server Processing   Content Transfer\n")
+	t.printf("[   %s  |     %s    |      %s      |      %s     ]\n", a(0), a(1), a(3), a(4))
+	t.printf("             |                |                   |                  |\n")
+	t.printf("    namelookup:%s        |                   |                  |\n", b(nameLookup))
+	t.printf("                        connect:%s           |                  |\n", b(connect))
+	t.printf("                                      starttransfer:%s          |\n", b(startTransfer))
+	t.printf("                                                                 total:%s\n", t.paint(ansiCyan, formatMillis(total)))
+}
+
+// centre pads s with spaces on both sides to the given width
+func centre(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	left := (width - len(s)) / 2
+	return strings.Repeat(" ", left) + s + strings.Repeat(" ", width-len(s)-left)
+}
+
+// waterfallURLWidth is the widest URL shown in a waterfall before it is
+// truncated
+const waterfallURLWidth = 60
+
+// WaterfallRow is one bar of a waterfall chart. Label is shown before the
+// URL, typically the status code, and Note after the bar's duration.
+type WaterfallRow struct {
+	Label  string
+	URL    string
+	Start  time.Time
+	Total  time.Duration
+	Timing Timing
+	Note   string
+}
+
+// writeWaterfall draws every hop of the redirect chain on a shared time axis
+func (t *textWriter) writeWaterfall(r *Result) {
+	rows := make([]WaterfallRow, 0, len(r.Redirects)+1)
+	for _, redirect := range r.Redirects {
+		rows = append(rows, WaterfallRow{
+			Label:  fmt.Sprintf("%d", redirect.StatusCode),
+			URL:    redirect.URL,
+			Start:  redirect.StartTime,
+			Total:  redirect.EndTime.Sub(redirect.StartTime),
+			Timing: redirect.Timing,
+		})
+	}
+	rows = append(rows, WaterfallRow{
+		Label:  fmt.Sprintf("%d", r.StatusCode),
+		URL:    r.URL,
+		Start:  r.StartTime,
+		Total:  r.Timing.Total,
+		Timing: r.Timing,
+	})
+	t.writeWaterfallRows("Redirect waterfall", rows)
+}
+
+// WriteWaterfall draws the given rows on a shared time axis, starting at
+// the earliest row
+func WriteWaterfall(w io.Writer, color bool, title string, rows []WaterfallRow) error {
+	t := &textWriter{w: w, color: color}
+	t.writeWaterfallRows(title, rows)
+	return t.err
+}
+
+// writeWaterfallRows draws one bar per row, split into the phases of its
+// timing
+func (t *textWriter) writeWaterfallRows(title string, rows []WaterfallRow) {
+	if len(rows) == 0 {
+		return
+	}
+
+	chainStart, chainEnd := rows[0].Start, rows[0].Start.Add(rows[0].Total)
+	labelWidth, urlWidth := 0, 0
+	for _, row := range rows {
+		if row.Start.Before(chainStart) {
+			chainStart = row.Start
+		}
+		if end := row.Start.Add(row.Total); end.After(chainEnd) {
+			chainEnd = end
+		}
+		if len(row.Label) > labelWidth {
+			labelWidth = len(row.Label)
+		}
+		if len(row.URL) > urlWidth {
+			urlWidth = len(row.URL)
+		}
+	}
+	if urlWidth > waterfallURLWidth {
+		urlWidth = waterfallURLWidth
+	}
+	span := chainEnd.Sub(chainStart)
+	if span <= 0 {
+		return
+	}
+
+	column := func(d time.Duration) int {
+		return int(float64(d) / float64(span) * waterfallWidth)
+	}
+
+	t.printf("\n%s (%s)\n", title, FormatDuration(span))
+	for _, row := range rows {
+		var bar strings.Builder
+		offset := row.Start.Sub(chainStart)
+		bar.WriteString(strings.Repeat(" ", column(offset)))
+		drawn := column(offset)
+
+		for i, d := range hopPhases(row.Timing) {
+			offset += d
+			width := column(offset) - drawn
+			if d > 0 && width == 0 {
+				width = 1
+			}
+			if drawn+width > waterfallWidth {
+				width = waterfallWidth - drawn
+			}
+			if width <= 0 {
+				continue
+			}
+			if t.color {
+				bar.WriteString(t.paint(textPhases[i].color, strings.Repeat("█", width)))
+			} else {
+				bar.WriteString(strings.Repeat(textPhases[i].symbol, width))
+			}
+			drawn += width
+		}
+		if drawn < waterfallWidth {
+			bar.WriteString(strings.Repeat(" ", waterfallWidth-drawn))
+		}
+
+		url := row.URL
+		if len(url) > urlWidth {
+			url = url[:urlWidth-3] + "..."
+		}
+		line := fmt.Sprintf("  %-*s %-*s |%s| %s", labelWidth, row.Label, urlWidth, url, bar.String(), FormatDuration(row.Total))
+		if row.Note != "" {
+			line += "  " + t.paint(ansiGray, row.Note)
+		}
+		t.printf("%s\n", line)
+	}
+
+	var legend []string
+	for _, phase := range textPhases {
+		if t.color {
+			legend = append(legend, t.paint(phase.color, "█")+" "+phase.name)
+		} else {
+			legend = append(legend, phase.symbol+" "+phase.name)
+		}
+	}
+	t.printf("  %s\n", strings.Join(legend, "  "))
+}
+
+// writeStatsTable prints one row per phase of the given statistics
+func (t *textWriter) writeStatsTable(s Stats) {
+	rows := []struct {
+		name  string
+		stats PhaseStats
+	}{
+		{"DNS Lookup", s.DNSLookup},
+		{"TCP Connection", s.TCPConnection},
+		{"TLS Handshake", s.TLSHandshake},
+		{"TTFB", s.TTFB},
+		{"TTLB", s.TTLB},
+	}
+
+	t.printf("\n%-16s %7s %10s %10s %10s %10s %10s %10s %10s\n",
+		"Phase", "Samples", "Min", "Mean", "StdDev", "P50", "P90", "P99", "Max")
+	for _, row := range rows {
+		ps := row.stats
+		t.printf("%-16s %7d %10s %10s %10s %10s %10s %10s %10s\n", row.name, ps.Samples,
+			FormatDuration(ps.Min), FormatDuration(ps.Mean), FormatDuration(ps.StdDev),
+			FormatDuration(ps.P50), FormatDuration(ps.P90), FormatDuration(ps.P99),
+			t.paint(ansiCyan, fmt.Sprintf("%10s", FormatDuration(ps.Max))))
+	}
+	t.printf("\n%d samples, %d reused connections\n", s.Samples, s.ReusedConnections)
+}
+
+// WriteText renders the repeated probe as a per-phase statistics table
+func (r *RepeatResult) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s\n", t.paint(ansiGray, "URL:"), r.URL)
+	t.writeStatsTable(r.Stats)
+	for _, err := range r.Errors {
+		t.printf("%s %v\n", t.paint(ansiMagenta, "Error:"), err)
+	}
+	return t.err
+}
+
+// WriteText renders the load run as a summary, a per-phase statistics table
+// and per-phase latency histograms
+func (r *LoadResult) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s\n", t.paint(ansiGray, "URL:"), r.URL)
+	t.printf("%s %d workers, %d requests in %s (%s req/s)\n", t.paint(ansiGray, "Load:"),
+		r.Concurrency, r.Requests, FormatDuration(r.Elapsed), t.paint(ansiCyan, fmt.Sprintf("%.1f", r.Throughput())))
+	if r.Errors > 0 {
+		var phases []string
+		for phase, count := range r.ErrorsByPhase {
+			phases = append(phases, fmt.Sprintf("%s=%d", phase, count))
+		}
+		sort.Strings(phases)
+		t.printf("%s %d (%s)\n", t.paint(ansiMagenta, "Errors:"), r.Errors, strings.Join(phases, ", "))
+	}
+	t.writeStatsTable(r.Stats)
+	t.writeHistograms(r.Histograms)
+	return t.err
+}
+
+// histogramWidth is the number of columns used for the longest histogram bar
+const histogramWidth = 40
+
+// writeHistograms draws a bar chart of each phase's latency histogram,
+// from its first to its last non-empty bucket. Phases without samples are
+// skipped.
+func (t *textWriter) writeHistograms(histograms map[string]Histogram) {
+	phases := []struct {
+		key   string
+		phase textPhase
+	}{
+		{"dns_lookup", textPhases[0]},
+		{"tcp_connection", textPhases[1]},
+		{"tls_handshake", textPhases[2]},
+		{"ttfb", textPhase{"TTFB", textPhases[3].color, textPhases[3].symbol}},
+		{"ttlb", textPhase{"TTLB", textPhases[4].color, textPhases[4].symbol}},
+	}
+
+	for _, p := range phases {
+		histogram := histograms[p.key]
+		first, last, max := -1, -1, 0
+		for i, bucket := range histogram {
+			if bucket.Count == 0 {
+				continue
+			}
+			if first < 0 {
+				first = i
+			}
+			last = i
+			if bucket.Count > max {
+				max = bucket.Count
+			}
+		}
+		if first < 0 {
+			continue
+		}
+
+		t.printf("\n%s\n", p.phase.name)
+		for _, bucket := range histogram[first : last+1] {
+			label := "> " + histogramBounds[len(histogramBounds)-1].String()
+			if bucket.UpperBound > 0 {
+				label = "<= " + bucket.UpperBound.String()
+			}
+			width := bucket.Count * histogramWidth / max
+			if bucket.Count > 0 && width == 0 {
+				width = 1
+			}
+			bar := strings.Repeat(p.phase.symbol, width)
+			if t.color {
+				bar = t.paint(p.phase.color, strings.Repeat("█", width))
+			}
+			t.printf("  %8s |%s%s| %d\n", label, bar, strings.Repeat(" ", histogramWidth-width), bucket.Count)
+		}
+	}
+}
+
+// WriteText renders the resumption test as one row per TLS version
+func (r *ResumeResult) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s (%s)\n\n", t.paint(ansiGray, "URL:"), r.URL, r.Addr)
+	t.printf("  %-8s %14s %14s %8s %16s\n", "Version", "Full", "Resumed", "Ticket", "Lifetime")
+	for _, a := range r.Attempts {
+		if a.Error != "" {
+			t.printf("  %-8s %s\n", a.Version, t.paint(ansiMagenta, a.Error))
+			continue
+		}
+		resumed := t.paint(ansiMagenta, fmt.Sprintf("%14s", "no"))
+		if a.Resumed {
+			resumed = t.paint(ansiGreen, fmt.Sprintf("%14s", FormatDuration(a.ResumeHandshake)))
+		}
+		ticket, lifetime := "no", "-"
+		if a.TicketReceived {
+			ticket = "yes"
+		}
+		if a.TicketLifetime > 0 {
+			lifetime = a.TicketLifetime.String()
+		} else if a.TicketReceived {
+			lifetime = "unknown"
+		}
+		t.printf("  %-8s %14s %s %8s %16s\n", a.Version, FormatDuration(a.FullHandshake), resumed, ticket, lifetime)
+	}
+	return t.err
+}
+
+// WriteText renders the scan as matrices of versions against cipher suites
+// and key exchange groups
+func (r *ScanResult) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s (%s)\n", t.paint(ansiGray, "URL:"), r.URL, r.Addr)
+
+	versions := make([]string, 0, len(r.Versions))
+	var accepted []string
+	for _, a := range r.Versions {
+		versions = append(versions, a.Version)
+		if a.Accepted {
+			accepted = append(accepted, a.Version)
+		}
+	}
+	if len(accepted) == 0 {
+		accepted = append(accepted, "none")
+	}
+	t.printf("%s %s\n", t.paint(ansiGray, "Accepted versions:"), strings.Join(accepted, ", "))
+
+	t.writeScanMatrix("Cipher suite", versions, r.CipherSuites, func(a ScanAttempt) string { return a.CipherSuite })
+	t.writeScanMatrix("Key exchange", versions, r.Curves, func(a ScanAttempt) string { return a.Curve })
+	return t.err
+}
+
+// writeScanMatrix prints one row per distinct key of the attempts, with a
+// handshake time per accepted version, "no" when rejected and "-" when the
+// row does not apply to the version
+func (t *textWriter) writeScanMatrix(title string, versions []string, attempts []ScanAttempt, key func(ScanAttempt) string) {
+	var names []string
+	cells := make(map[string]map[string]ScanAttempt)
+	nameWidth := len(title)
+	for _, a := range attempts {
+		name := key(a)
+		if _, ok := cells[name]; !ok {
+			names = append(names, name)
+			cells[name] = make(map[string]ScanAttempt)
+			if len(name) > nameWidth {
+				nameWidth = len(name)
+			}
+		}
+		cells[name][a.Version] = a
+	}
+
+	t.printf("\n  %-*s", nameWidth, title)
+	for _, version := range versions {
+		t.printf(" %10s", version)
+	}
+	t.printf("\n")
+	for _, name := range names {
+		t.printf("  %-*s", nameWidth, name)
+		for _, version := range versions {
+			a, ok := cells[name][version]
+			switch {
+			case !ok:
+				t.printf(" %10s", "-")
+			case a.Accepted:
+				t.printf(" %s", t.paint(ansiGreen, fmt.Sprintf("%10s", FormatDuration(a.Handshake))))
+			default:
+				t.printf(" %s", t.paint(ansiMagenta, fmt.Sprintf("%10s", "no")))
+			}
+		}
+		t.printf("\n")
+	}
+}
+
+// WriteText renders the probes of every address as a comparison table,
+// followed by the reasons each outlier was flagged
+func (r *AllAddrsResult) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s (%s)\n\n", t.paint(ansiGray, "URL:"), r.URL, r.Host)
+	t.printf("  %-39s %6s %10s %10s %10s %10s\n", "Address", "Status", "Connect", "TLS", "TTFB", "Total")
+	for _, a := range r.Addrs {
+		addr := fmt.Sprintf("%-39s", a.Addr)
+		if len(a.Outliers) > 0 {
+			addr = t.paint(ansiYellow, addr)
+		}
+		if a.Result == nil {
+			t.printf("  %s %s\n", addr, t.paint(ansiMagenta, a.Err.Error()))
+			continue
+		}
+		first := a.Result.FirstHop()
+		t.printf("  %s %6d %10s %10s %10s %s\n", addr, a.Result.StatusCode,
+			FormatDuration(first.TCPConnection), FormatDuration(first.TLSHandshake), FormatDuration(first.ServerProcessing),
+			t.paint(ansiCyan, fmt.Sprintf("%10s", FormatDuration(a.Result.TotalTime()))))
+	}
+
+	var flagged bool
+	for _, a := range r.Addrs {
+		if len(a.Outliers) == 0 {
+			continue
+		}
+		if !flagged {
+			t.printf("\n%s\n", t.paint(ansiGray, "Outliers:"))
+			flagged = true
+		}
+		t.printf("  %s: %s\n", t.paint(ansiYellow, a.Addr), strings.Join(a.Outliers, "; "))
+	}
+	return t.err
+}
+
+// WriteText renders the family comparison as one row per probe, followed by
+// the IPv6 minus IPv4 delta of each phase
+func (c *FamilyComparison) WriteText(w io.Writer, color bool) error {
+	t := &textWriter{w: w, color: color}
+	t.printf("%s %s\n\n", t.paint(ansiGray, "URL:"), c.URL)
+	t.printf("  %-9s %-6s %-8s", "Probe", "Family", "Fallback")
+	for _, phase := range familyPhases {
+		t.printf(" %10s", strings.ToUpper(phase.name))
+	}
+	t.printf("\n")
+
+	for _, run := range c.Runs {
+		if run.Result == nil {
+			t.printf("  %-9s %s\n", run.Name, t.paint(ansiMagenta, run.Err.Error()))
+			continue
+		}
+		family, fellBack := firstHopFamily(run.Result)
+		fallback := "no"
+		if fellBack {
+			fallback = t.paint(ansiYellow, fmt.Sprintf("%-8s", "yes"))
+		}
+		t.printf("  %-9s %-6s %-8s", run.Name, family, fallback)
+		for _, phase := range familyPhases {
+			t.printf(" %10s", FormatDuration(phase.value(run.Result)))
+		}
+		t.printf("\n")
+	}
+
+	if deltas := c.Deltas(); deltas != nil {
+		t.printf("  %-25s", "IPv6 - IPv4")
+		for _, phase := range familyPhases {
+			d := formatDelta(deltas[phase.name])
+			if deltas[phase.name] > 0 {
+				d = t.paint(ansiYellow, fmt.Sprintf("%10s", d))
+			} else {
+				d = t.paint(ansiGreen, fmt.Sprintf("%10s", d))
+			}
+			t.printf(" %s", d)
+		}
+		t.printf("\n")
+	}
+	return t.err
+}
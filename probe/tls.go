@@ -0,0 +1,157 @@
+package probe
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TLSInfo describes the TLS connection a hop was sent over
+type TLSInfo struct {
+	Version          string
+	CipherSuite      string
+	ALPN             string // Negotiated application protocol, empty if none
+	ServerName       string // SNI sent to the server
+	Resumed          bool
+	OCSPStapled      bool
+	Pin              *PinMatch // Certificate matching a pin, nil when not pinning
+	Certificates     []CertificateInfo
+	PeerCertificates []*x509.Certificate // Chain as sent by the server, leaf first
+}
+
+// CertificateInfo describes one certificate of the peer chain
+type CertificateInfo struct {
+	Subject            string
+	Issuer             string
+	SANs               []string
+	Serial             string
+	KeyType            string
+	SignatureAlgorithm string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	DaysToExpiry       int // Whole days from the handshake to NotAfter
+}
+
+// newTLSInfo summarizes a connection state, measuring certificate expiry
+// from now and matching the chain against pins
+func newTLSInfo(cs *tls.ConnectionState, now time.Time, pins []string) *TLSInfo {
+	if cs == nil {
+		return nil
+	}
+	info := &TLSInfo{
+		Version:          tls.VersionName(cs.Version),
+		CipherSuite:      tls.CipherSuiteName(cs.CipherSuite),
+		ALPN:             cs.NegotiatedProtocol,
+		ServerName:       cs.ServerName,
+		Resumed:          cs.DidResume,
+		OCSPStapled:      len(cs.OCSPResponse) > 0,
+		PeerCertificates: cs.PeerCertificates,
+	}
+	if len(pins) > 0 {
+		info.Pin = matchPins(pinnedChains(cs), pins)
+	}
+	for _, cert := range cs.PeerCertificates {
+		info.Certificates = append(info.Certificates, newCertificateInfo(cert, now))
+	}
+	return info
+}
+
+// newCertificateInfo summarizes a certificate
+func newCertificateInfo(cert *x509.Certificate, now time.Time) CertificateInfo {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SANs:               sans,
+		Serial:             strings.ToUpper(cert.SerialNumber.Text(16)),
+		KeyType:            keyType(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DaysToExpiry:       int(cert.NotAfter.Sub(now).Hours() / 24),
+	}
+}
+
+// keyType describes the certificate's public key, such as "RSA 2048"
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// CertificateJSON represents a certificate in JSON format
+type CertificateJSON struct {
+	Subject            string   `json:"subject"`
+	Issuer             string   `json:"issuer"`
+	SANs               []string `json:"sans,omitempty"`
+	Serial             string   `json:"serial"`
+	KeyType            string   `json:"key_type"`
+	SignatureAlgorithm string   `json:"signature_algorithm"`
+	NotBefore          string   `json:"not_before"`
+	NotAfter           string   `json:"not_after"`
+	DaysToExpiry       int      `json:"days_to_expiry"`
+}
+
+// TLSJSON represents TLS connection details in JSON format
+type TLSJSON struct {
+	Version      string            `json:"version"`
+	CipherSuite  string            `json:"cipher_suite"`
+	ALPN         string            `json:"alpn,omitempty"`
+	ServerName   string            `json:"server_name,omitempty"`
+	Resumed      bool              `json:"resumed"`
+	OCSPStapled  bool              `json:"ocsp_stapled"`
+	Pin          *PinMatchJSON     `json:"pin,omitempty"`
+	Certificates []CertificateJSON `json:"certificates"`
+}
+
+// JSON converts the TLS details into their JSON representation
+func (t *TLSInfo) JSON() *TLSJSON {
+	if t == nil {
+		return nil
+	}
+	result := &TLSJSON{
+		Version:      t.Version,
+		CipherSuite:  t.CipherSuite,
+		ALPN:         t.ALPN,
+		ServerName:   t.ServerName,
+		Resumed:      t.Resumed,
+		OCSPStapled:  t.OCSPStapled,
+		Certificates: make([]CertificateJSON, 0, len(t.Certificates)),
+	}
+	if t.Pin != nil {
+		result.Pin = &PinMatchJSON{Chain: t.Pin.Chain, Position: t.Pin.Position, Pin: t.Pin.Pin, Subject: t.Pin.Subject}
+	}
+	for _, cert := range t.Certificates {
+		result.Certificates = append(result.Certificates, CertificateJSON{
+			Subject:            cert.Subject,
+			Issuer:             cert.Issuer,
+			SANs:               cert.SANs,
+			Serial:             cert.Serial,
+			KeyType:            cert.KeyType,
+			SignatureAlgorithm: cert.SignatureAlgorithm,
+			NotBefore:          cert.NotBefore.UTC().Format(time.RFC3339),
+			NotAfter:           cert.NotAfter.UTC().Format(time.RFC3339),
+			DaysToExpiry:       cert.DaysToExpiry,
+		})
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// TLSOptions configures the TLS client used for HTTPS hops
+type TLSOptions struct {
+	RootCAs      *x509.CertPool    // Trusted roots, the system roots when nil
+	Certificates []tls.Certificate // Client certificates for mutual TLS
+	Insecure     bool              // Skip verification of the server's certificate chain and name
+	MinVersion   uint16            // Lowest TLS version offered, zero for the default
+	MaxVersion   uint16            // Highest TLS version offered, zero for the default
+	CipherSuites []uint16          // TLS 1.0-1.2 cipher suites, Go's defaults when empty
+	ServerName   string            // SNI and verification name, the URL host when empty
+	Pins         []string          // SPKI pins such as sha256//BASE64, one must match the chain
+}
+
+// newTLSConfig builds the client TLS configuration for a transport.
+// defaultMin and defaultMax apply when the options leave a version unset.
+func newTLSConfig(opts TLSOptions, defaultMin, defaultMax uint16) *tls.Config {
+	config := &tls.Config{
+		RootCAs:            opts.RootCAs,
+		Certificates:       opts.Certificates,
+		InsecureSkipVerify: opts.Insecure,
+		MinVersion:         opts.MinVersion,
+		MaxVersion:         opts.MaxVersion,
+		CipherSuites:       opts.CipherSuites,
+		ServerName:         opts.ServerName,
+		ClientSessionCache: tls.NewLRUClientSessionCache(100),
+	}
+	if len(opts.Pins) > 0 {
+		config.VerifyConnection = verifyPins(opts.Pins)
+	}
+	// A default must not contradict an explicitly requested version
+	if config.MinVersion == 0 && (config.MaxVersion == 0 || defaultMin <= config.MaxVersion) {
+		config.MinVersion = defaultMin
+	}
+	if config.MaxVersion == 0 && (defaultMax == 0 || defaultMax >= config.MinVersion) {
+		config.MaxVersion = defaultMax
+	}
+	// crypto/tls reads an unset MinVersion as TLS 1.2 on clients, which
+	// leaves no version to offer when the maximum is below it
+	if config.MinVersion == 0 && config.MaxVersion != 0 && config.MaxVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS10
+	}
+	return config
+}
+
+// tlsVersions maps version names accepted on the command line
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2"
+func ParseTLSVersion(s string) (uint16, error) {
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(s), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites parses a comma-separated list of cipher suite names,
+// such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure suites are
+// accepted too, since probing for them is the point. TLS 1.3 suites are
+// rejected, as crypto/tls ignores them in Config.CipherSuites.
+func ParseCipherSuites(s string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	tls13Only := make(map[string]bool)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+		tls13Only[suite.Name] = !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 })
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		if tls13Only[strings.ToUpper(name)] {
+			return nil, fmt.Errorf("cipher suite %q is TLS 1.3 only, and TLS 1.3 suites cannot be configured", name)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no cipher suites given")
+	}
+	return ids, nil
+}
+
+// LoadCACerts reads a PEM bundle of trusted root certificates
+func LoadCACerts(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// LoadClientCertificate reads a client certificate and its private key.
+// certFile may be a PEM certificate with keyFile holding the PEM key, a PEM
+// file holding both when keyFile is empty, or a PKCS#12 bundle decrypted
+// with password.
+func LoadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error reading client certificate: %w", err)
+	}
+
+	if block, _ := pem.Decode(data); block == nil {
+		// Not PEM, so it should be a PKCS#12 bundle
+		if keyFile != "" {
+			return tls.Certificate{}, fmt.Errorf("%s is not a PEM certificate", certFile)
+		}
+		key, cert, chain, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("error decoding PKCS#12 client certificate: %w", err)
+		}
+		certificate := tls.Certificate{PrivateKey: key, Leaf: cert, Certificate: [][]byte{cert.Raw}}
+		for _, c := range chain {
+			certificate.Certificate = append(certificate.Certificate, c.Raw)
+		}
+		return certificate, nil
+	}
+
+	keyData := data
+	if keyFile != "" {
+		if keyData, err = os.ReadFile(keyFile); err != nil {
+			return tls.Certificate{}, fmt.Errorf("error reading client key: %w", err)
+		}
+	}
+	certificate, err := tls.X509KeyPair(data, keyData)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("error loading client certificate: %w", err)
+	}
+	return certificate, nil
+}
@@ -0,0 +1,184 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []uint16
+		wantErr string
+	}{
+		{
+			input: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			want:  []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		},
+		{
+			input: " tls_ecdhe_ecdsa_with_aes_256_gcm_sha384 , TLS_RSA_WITH_AES_128_CBC_SHA,",
+			want:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+		},
+		{input: "TLS_AES_128_GCM_SHA256", wantErr: "TLS 1.3 only"},
+		{input: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_CHACHA20_POLY1305_SHA256", wantErr: "TLS 1.3 only"},
+		{input: "TLS_NOT_A_SUITE", wantErr: "unknown cipher suite"},
+		{input: " , ", wantErr: "no cipher suites"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCipherSuites(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCipherSuites(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCipherSuites(%q) error = %v", tt.input, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseCipherSuites(%q) = %v, want %v", tt.input, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseCipherSuites(%q) = %v, want %v", tt.input, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNewTLSConfigVersions(t *testing.T) {
+	tests := []struct {
+		name                   string
+		min, max               uint16
+		defaultMin, defaultMax uint16
+		wantMin, wantMax       uint16
+	}{
+		{name: "defaults", wantMin: 0, wantMax: 0},
+		{name: "explicit", min: tls.VersionTLS11, max: tls.VersionTLS12, wantMin: tls.VersionTLS11, wantMax: tls.VersionTLS12},
+		{name: "max 1.0 without min", max: tls.VersionTLS10, wantMin: tls.VersionTLS10, wantMax: tls.VersionTLS10},
+		{name: "max 1.1 without min", max: tls.VersionTLS11, wantMin: tls.VersionTLS10, wantMax: tls.VersionTLS11},
+		{name: "max 1.2 without min", max: tls.VersionTLS12, wantMin: 0, wantMax: tls.VersionTLS12},
+		{name: "default max", defaultMax: tls.VersionTLS12, wantMin: 0, wantMax: tls.VersionTLS12},
+		{name: "default max below min", min: tls.VersionTLS13, defaultMax: tls.VersionTLS12, wantMin: tls.VersionTLS13, wantMax: 0},
+		{name: "default min", defaultMin: tls.VersionTLS12, wantMin: tls.VersionTLS12, wantMax: 0},
+		{name: "default min above max", max: tls.VersionTLS11, defaultMin: tls.VersionTLS12, wantMin: tls.VersionTLS10, wantMax: tls.VersionTLS11},
+	}
+
+	for _, tt := range tests {
+		config := newTLSConfig(TLSOptions{MinVersion: tt.min, MaxVersion: tt.max}, tt.defaultMin, tt.defaultMax)
+		if config.MinVersion != tt.wantMin || config.MaxVersion != tt.wantMax {
+			t.Errorf("%s: versions %#x-%#x, want %#x-%#x", tt.name, config.MinVersion, config.MaxVersion, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestMaxVersionBelowTLS12(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS10}
+	server.StartTLS()
+	defer server.Close()
+
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11} {
+		result, err := Run(context.Background(), Options{
+			URL:     server.URL,
+			Timeout: 5 * time.Second,
+			TLS:     TLSOptions{Insecure: true, MaxVersion: version},
+		})
+		if err != nil {
+			t.Errorf("probe with a maximum of %s failed: %v", tls.VersionName(version), err)
+			continue
+		}
+		if got := result.TLS.Version; got != tls.VersionName(version) {
+			t.Errorf("negotiated %s, want %s", got, tls.VersionName(version))
+		}
+	}
+}
+
+// sniRecorder is a TLS test server that records the server name of every
+// request it receives
+type sniRecorder struct {
+	*httptest.Server
+	mu    sync.Mutex
+	names []string
+}
+
+func newSNIRecorder(handler http.HandlerFunc) *sniRecorder {
+	r := &sniRecorder{}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.names = append(r.names, req.TLS.ServerName)
+		r.mu.Unlock()
+		handler(w, req)
+	}))
+	return r
+}
+
+func (r *sniRecorder) serverNames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+func TestServerNameOnlyAppliesToProbedHost(t *testing.T) {
+	other := newSNIRecorder(func(w http.ResponseWriter, r *http.Request) {})
+	defer other.Close()
+	otherPort := mustPort(t, other.URL)
+
+	origin := newSNIRecorder(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/same", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "https://other.test:"+otherPort+"/", http.StatusFound)
+	})
+	defer origin.Close()
+	originPort := mustPort(t, origin.URL)
+
+	p, err := New(Options{
+		URL:     "https://origin.test:" + originPort + "/",
+		Timeout: 5 * time.Second,
+		Resolve: []ResolveRule{
+			{Host: "origin.test", Port: originPort, Addrs: []string{"127.0.0.1"}},
+			{Host: "other.test", Port: otherPort, Addrs: []string{"127.0.0.1"}},
+		},
+		TLS: TLSOptions{Insecure: true, ServerName: "sni.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Redirects) != 2 {
+		t.Fatalf("got %d redirects, want 2", len(result.Redirects))
+	}
+
+	if got := origin.serverNames(); len(got) != 2 || got[0] != "sni.example.com" || got[1] != "sni.example.com" {
+		t.Errorf("probed host saw server names %v, want sni.example.com for both hops", got)
+	}
+	if got := other.serverNames(); len(got) != 1 || got[0] != "other.test" {
+		t.Errorf("redirect target saw server names %v, want other.test", got)
+	}
+}
+
+// mustPort returns the port of a test server URL
+func mustPort(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Port()
+}
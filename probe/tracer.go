@@ -0,0 +1,447 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEvent is a single structured entry in a probe's trace
+type TraceEvent struct {
+	Phase   string                 `json:"phase"`
+	Event   string                 `json:"event"`
+	Offset  time.Duration          `json:"offset_ns"`
+	Time    time.Time              `json:"time"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// String renders the event as a human readable, timestamped trace line
+func (e TraceEvent) String() string {
+	return fmt.Sprintf("%s: %s", e.Time.Format("2006-01-02 15:04:05.000"), e.Message)
+}
+
+// FormatTrace renders events as human readable trace lines
+func FormatTrace(events []TraceEvent) []string {
+	lines := make([]string, 0, len(events))
+	for _, e := range events {
+		lines = append(lines, e.String())
+	}
+	return lines
+}
+
+// Trace phases
+const (
+	PhaseDNS        = "dns"
+	PhaseConnect    = "connect"
+	PhaseTLS        = "tls"
+	PhaseConnection = "connection"
+	PhaseResponse   = "response"
+	PhaseRequest    = "request"
+)
+
+// traceRecorder collects the trace events and timing of a single probe
+// run. httptrace callbacks may fire from several goroutines at once, so all
+// state owned by the run, including the Timing values of each hop, is
+// guarded by mu.
+type traceRecorder struct {
+	mu             sync.Mutex
+	start          time.Time
+	customResolver bool
+	pins           []string
+	events         []TraceEvent
+	hop            int
+	hopStart       int
+	connState      *tls.ConnectionState // Handshake of the current hop, if any
+	dns            *DNSInfo             // Lookup of the current hop, if any
+	dnsQueries     []DNSQuery           // Custom resolver queries not yet claimed by a lookup
+	dialOverride   *DialOverride        // Rules applied to the current hop's connection, if any
+	firstFamily    string               // Family of the current hop's first connect attempt
+	family         string               // Family of the current hop's connection
+	familyFallback bool                 // Connection used another family than first attempted
+	race           connectRace          // Connection attempts of the current hop
+	localAddr      string               // Local address of the current hop's connection
+	remoteAddr     string               // Remote address of the current hop's connection
+}
+
+// newTraceRecorder creates an empty recorder for one probe run starting now
+func newTraceRecorder(customResolver bool, pins []string) *traceRecorder {
+	return &traceRecorder{start: time.Now(), customResolver: customResolver, pins: pins}
+}
+
+// traceRecorderContextKey stores the run's recorder in the request context
+type traceRecorderContextKey struct{}
+
+// recorderFromContext returns the recorder attached to ctx, if any
+func recorderFromContext(ctx context.Context) *traceRecorder {
+	rec, _ := ctx.Value(traceRecorderContextKey{}).(*traceRecorder)
+	return rec
+}
+
+// addTraceEvent adds an event to the trace log
+func (r *traceRecorder) addTraceEvent(phase, event string, attrs map[string]interface{}, format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addTraceEventLocked(phase, event, attrs, format, args...)
+}
+
+// addTraceEventLocked adds an event to the trace log, r.mu must be held
+func (r *traceRecorder) addTraceEventLocked(phase, event string, attrs map[string]interface{}, format string, args ...interface{}) {
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+
+	// Deduplicate events within a hop that occur within 10ms of each other
+	if n := len(r.events); n > r.hopStart {
+		last := r.events[n-1]
+		if last.Event == event && last.Message == msg && now.Sub(last.Time) < 10*time.Millisecond {
+			return
+		}
+	}
+
+	r.events = append(r.events, TraceEvent{
+		Phase:   phase,
+		Event:   event,
+		Offset:  now.Sub(r.start),
+		Time:    now,
+		Message: msg,
+		Attrs:   attrs,
+	})
+}
+
+// nextHop ends the current hop and returns the events recorded during it.
+// Tracers created for earlier hops stop recording once the hop advances.
+func (r *traceRecorder) nextHop() []TraceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hopEvents := append([]TraceEvent(nil), r.events[r.hopStart:]...)
+	r.hop++
+	r.hopStart = len(r.events)
+	r.connState = nil
+	r.dns = nil
+	r.dnsQueries = nil
+	r.dialOverride = nil
+	r.firstFamily = ""
+	r.family = ""
+	r.familyFallback = false
+	r.race = connectRace{}
+	r.localAddr = ""
+	r.remoteAddr = ""
+	return hopEvents
+}
+
+// tlsInfo returns the TLS details of the current hop. Reused connections
+// skip the handshake, so their state comes from the response instead.
+func (r *traceRecorder) tlsInfo(resp *http.Response) *TLSInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cs := r.connState
+	if cs == nil {
+		cs = resp.TLS
+	}
+	return newTLSInfo(cs, time.Now(), r.pins)
+}
+
+// addDNSQuery records a query answered, or failed, by the custom resolver.
+// Queries are claimed by the lookup that completes next.
+func (r *traceRecorder) addDNSQuery(q DNSQuery) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dnsQueries = append(r.dnsQueries, q)
+}
+
+// dnsInfo returns the DNS lookup of the current hop, nil when the hop
+// reused a connection or dialed an IP address
+func (r *traceRecorder) dnsInfo() *DNSInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dns
+}
+
+// setDialOverride records the rules applied to the current hop's connection
+func (r *traceRecorder) setDialOverride(o *DialOverride) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialOverride = o
+}
+
+// dialOverrideInfo returns the rules applied to the current hop's
+// connection, nil when none matched or the connection was reused
+func (r *traceRecorder) dialOverrideInfo() *DialOverride {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dialOverride
+}
+
+// connectAttempts returns the connection attempts of the current hop
+func (r *traceRecorder) connectAttempts() []ConnectAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnectAttempt(nil), r.race.attempts...)
+}
+
+// connFamily returns the IP family of the current hop's connection, and
+// whether it fell back from the family first attempted
+func (r *traceRecorder) connFamily() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.family, r.familyFallback
+}
+
+// connAddrs returns the local and remote addresses of the current hop's
+// connection
+func (r *traceRecorder) connAddrs() (string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.localAddr, r.remoteAddr
+}
+
+// Events returns a copy of all trace events in chronological order
+func (r *traceRecorder) Events() []TraceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TraceEvent(nil), r.events...)
+}
+
+// snapshotRequest returns a copy of request taken while no callback is writing it
+func (r *traceRecorder) snapshotRequest(request *RequestInfo) RequestInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *request
+}
+
+// currentPhase returns the phase the run was in when the last event was
+// recorded, which is where a failing run gave up
+func (r *traceRecorder) currentPhase() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		return PhaseConnection
+	}
+	last := r.events[len(r.events)-1]
+	if last.Event == "got_conn" || last.Event == "wrote_request" {
+		// The connection is ready, so the request is waiting on the server
+		return PhaseResponse
+	}
+	return last.Phase
+}
+
+// snapshot returns a copy of timing taken while no callback is writing it
+func (r *traceRecorder) snapshot(timing *Timing) Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *timing
+}
+
+// createTracer creates a new trace with timing information for the
+// recorder's current hop
+func createTracer(timing *Timing, request *RequestInfo, rec *traceRecorder) *httptrace.ClientTrace {
+	var start, dns, tlsHandshake time.Time
+	var gotConn, firstByte time.Time
+
+	rec.mu.Lock()
+	hop := rec.hop
+	rec.mu.Unlock()
+
+	// record runs fn under the recorder lock, unless a later hop has started.
+	// Redirected requests inherit the previous hop's trace through the
+	// request context, so stale tracers must stay silent.
+	record := func(fn func()) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if rec.hop == hop {
+			fn()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(dsi httptrace.DNSStartInfo) {
+			record(func() {
+				dns = time.Now()
+				rec.dns = &DNSInfo{Host: dsi.Host}
+				// Get system DNS servers if not using custom ones
+				if !rec.customResolver {
+					if servers := getSystemDNSServers(); len(servers) > 0 {
+						rec.addTraceEventLocked(PhaseDNS, "system_servers", map[string]interface{}{"servers": servers},
+							"Using system DNS servers: %s", strings.Join(servers, ", "))
+					}
+				}
+				rec.addTraceEventLocked(PhaseDNS, "dns_start", map[string]interface{}{"host": dsi.Host},
+					"DNS lookup starting for %s", dsi.Host)
+			})
+		},
+		DNSDone: func(ddi httptrace.DNSDoneInfo) {
+			record(func() {
+				timing.DNSLookup = time.Since(dns)
+				info := rec.dns
+				if info == nil {
+					info = &DNSInfo{}
+					rec.dns = info
+				}
+				info.Coalesced = ddi.Coalesced
+				for _, addr := range ddi.Addrs {
+					info.Addrs = append(info.Addrs, addr.String())
+				}
+				info.Queries = rec.dnsQueries
+				rec.dnsQueries = nil
+				for _, q := range info.Queries {
+					if q.Error == "" && !slices.Contains(info.Servers, q.Server) {
+						info.Servers = append(info.Servers, q.Server)
+					}
+				}
+
+				attrs := map[string]interface{}{"coalesced": ddi.Coalesced, "addrs": info.Addrs}
+				if ddi.Err != nil {
+					info.Error = ddi.Err.Error()
+					attrs["error"] = ddi.Err.Error()
+					rec.addTraceEventLocked(PhaseDNS, "dns_done", attrs, "DNS lookup failed: %v", ddi.Err)
+				} else {
+					rec.addTraceEventLocked(PhaseDNS, "dns_done", attrs, "DNS lookup completed")
+				}
+			})
+		},
+		ConnectStart: func(network, addr string) {
+			record(func() {
+				rec.race.start(addr, time.Now())
+				if rec.firstFamily == "" {
+					rec.firstFamily = familyOf(addr)
+				}
+				rec.addTraceEventLocked(PhaseConnect, "connect_start", map[string]interface{}{"network": network, "addr": addr},
+					"Connection attempt to %s", addr)
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			record(func() {
+				elapsed, extended := rec.race.done(addr, err, time.Now())
+				if extended {
+					timing.TCPConnection = elapsed
+				}
+				attrs := map[string]interface{}{"network": network, "addr": addr}
+				if err != nil {
+					attrs["error"] = err.Error()
+					rec.addTraceEventLocked(PhaseConnect, "connect_done", attrs, "Connection to %s failed: %v", addr, err)
+				} else {
+					// Only the first successful attempt of a race is used
+					attrs["winner"] = extended
+					rec.addTraceEventLocked(PhaseConnect, "connect_done", attrs, "Connected to %s", addr)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			record(func() {
+				tlsHandshake = time.Now()
+				rec.addTraceEventLocked(PhaseTLS, "tls_start", nil, "TLS handshake starting")
+			})
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			record(func() {
+				timing.TLSHandshake = time.Since(tlsHandshake)
+				var pinErr *PinError
+				if errors.As(err, &pinErr) {
+					rec.addTraceEventLocked(PhasePin, "pin_mismatch", map[string]interface{}{"chain": pinErr.Chain},
+						"No certificate matches the pinned keys")
+				}
+				if err != nil {
+					rec.addTraceEventLocked(PhaseTLS, "tls_done", map[string]interface{}{"error": err.Error()},
+						"TLS handshake failed: %v", err)
+				} else {
+					rec.connState = &cs
+					rec.addTraceEventLocked(PhaseTLS, "tls_done", map[string]interface{}{
+						"version":      tls.VersionName(cs.Version),
+						"cipher_suite": tls.CipherSuiteName(cs.CipherSuite),
+						"alpn":         cs.NegotiatedProtocol,
+						"resumed":      cs.DidResume,
+					}, "TLS handshake completed: %s, %s", tls.VersionName(cs.Version), tls.CipherSuiteName(cs.CipherSuite))
+					if len(rec.pins) > 0 {
+						if match := matchPins(pinnedChains(&cs), rec.pins); match != nil {
+							rec.addTraceEventLocked(PhasePin, "pin_match", map[string]interface{}{
+								"chain":    match.Chain,
+								"position": match.Position,
+								"pin":      match.Pin,
+							}, "Pinned key matched at chain position %d (%s)", match.Position, match.Subject)
+						}
+					}
+				}
+			})
+		},
+		WroteHeaderField: func(key string, value []string) {
+			record(func() {
+				if request.Header == nil {
+					request.Header = make(http.Header)
+				}
+				// Count each field as it would appear in an HTTP/1.x request
+				for _, v := range value {
+					request.Header[key] = append(request.Header[key], v)
+					request.HeaderBytes += len(key) + len(": ") + len(v) + len("\r\n")
+				}
+			})
+		},
+		WroteRequest: func(wri httptrace.WroteRequestInfo) {
+			record(func() {
+				timing.RequestWrite = time.Since(gotConn)
+				attrs := map[string]interface{}{"method": request.Method, "header_bytes": request.HeaderBytes}
+				if wri.Err != nil {
+					attrs["error"] = wri.Err.Error()
+					rec.addTraceEventLocked(PhaseRequest, "wrote_request", attrs, "Writing request failed: %v", wri.Err)
+				} else {
+					rec.addTraceEventLocked(PhaseRequest, "wrote_request", attrs, "%s request written", request.Method)
+				}
+			})
+		},
+		GotFirstResponseByte: func() {
+			record(func() {
+				firstByte = time.Now()
+				timing.ServerProcessing = firstByte.Sub(start)
+				rec.addTraceEventLocked(PhaseResponse, "first_byte", nil, "First response byte received (TTFB)")
+			})
+		},
+		GetConn: func(hostPort string) {
+			record(func() {
+				start = time.Now()
+				rec.addTraceEventLocked(PhaseConnection, "get_conn", map[string]interface{}{"host": hostPort},
+					"Getting connection for %s", hostPort)
+			})
+		},
+		GotConn: func(connInfo httptrace.GotConnInfo) {
+			record(func() {
+				gotConn = time.Now()
+				rec.addTraceEventLocked(PhaseConnection, "got_conn", map[string]interface{}{
+					"reused":       connInfo.Reused,
+					"was_idle":     connInfo.WasIdle,
+					"idle_time_ns": connInfo.IdleTime,
+				}, "Got connection: reused=%v, was_idle=%v, idle_time=%v",
+					connInfo.Reused, connInfo.WasIdle, connInfo.IdleTime)
+				timing.ReusedConnection = connInfo.Reused
+				rec.localAddr = connInfo.Conn.LocalAddr().String()
+				rec.remoteAddr = connInfo.Conn.RemoteAddr().String()
+				rec.family = familyOf(rec.remoteAddr)
+				rec.familyFallback = !connInfo.Reused && rec.firstFamily != "" && rec.family != "" && rec.family != rec.firstFamily
+				if rec.familyFallback {
+					rec.addTraceEventLocked(PhaseConnect, "family_fallback", map[string]interface{}{"from": rec.firstFamily, "to": rec.family},
+						"Fell back from %s to %s", rec.firstFamily, rec.family)
+				}
+				if connInfo.Reused {
+					// Reset timing information for reused connections
+					timing.DNSLookup = 0
+					timing.TCPConnection = 0
+					timing.TLSHandshake = 0
+				}
+			})
+		},
+	}
+}
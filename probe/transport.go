@@ -1,25 +1,26 @@
-package main
+package probe
 
 import (
 	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
 // dialContextFunc is a type for the DialContext function
 type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
 
-// createTransport creates an HTTP transport with the specified configuration
-func createTransport(useHTTP1, useHTTP11, noKeepAlive bool, dialContext dialContextFunc) *http.Transport {
+// createTransport creates an HTTP transport with the specified configuration.
+// Every branch gets its own TLS configuration built from tlsOpts, with a
+// session cache so resumption behaves the same for all protocols.
+func createTransport(useHTTP1, useHTTP11, noKeepAlive bool, dialContext dialContextFunc, tlsOpts TLSOptions) *http.Transport {
 	switch {
 	case useHTTP1:
 		return &http.Transport{
-			TLSNextProto: make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-			TLSClientConfig: &tls.Config{
-				MaxVersion: tls.VersionTLS12,
-			},
+			TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
+			TLSClientConfig:       newTLSConfig(tlsOpts, 0, tls.VersionTLS12),
 			ForceAttemptHTTP2:     false,
 			DisableKeepAlives:     noKeepAlive,
 			MaxIdleConns:          100,
@@ -34,6 +35,7 @@ func createTransport(useHTTP1, useHTTP11, noKeepAlive bool, dialContext dialCont
 	case useHTTP11:
 		return &http.Transport{
 			TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
+			TLSClientConfig:       newTLSConfig(tlsOpts, 0, 0),
 			ForceAttemptHTTP2:     false,
 			DisableKeepAlives:     noKeepAlive,
 			MaxIdleConns:          100,
@@ -57,11 +59,29 @@ func createTransport(useHTTP1, useHTTP11, noKeepAlive bool, dialContext dialCont
 			ExpectContinueTimeout: 1 * time.Second,
 			DisableCompression:    true,
 			DialContext:           dialContext,
-			TLSClientConfig: &tls.Config{
-				MinVersion:         tls.VersionTLS12,
-				InsecureSkipVerify: false,
-				ClientSessionCache: tls.NewLRUClientSessionCache(100),
-			},
+			TLSClientConfig:       newTLSConfig(tlsOpts, tls.VersionTLS12, 0),
 		}
 	}
 }
+
+// sniTransport sends requests to the probed host over a transport with the
+// server name set by TLSOptions.ServerName, and requests to any other host of
+// a redirect chain over one that sends the host's own name
+type sniTransport struct {
+	host  string // Hostname the server name applies to
+	sni   *http.Transport
+	other *http.Transport
+}
+
+func (t *sniTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.EqualFold(req.URL.Hostname(), t.host) {
+		return t.sni.RoundTrip(req)
+	}
+	return t.other.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports
+func (t *sniTransport) CloseIdleConnections() {
+	t.sni.CloseIdleConnections()
+	t.other.CloseIdleConnections()
+}
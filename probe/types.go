@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timing holds timing information for various stages of the HTTP request
+type Timing struct {
+	DNSLookup        time.Duration
+	TCPConnection    time.Duration
+	TLSHandshake     time.Duration
+	RequestWrite     time.Duration // From getting the connection to the request being written
+	ServerProcessing time.Duration
+	ContentTransfer  time.Duration
+	Total            time.Duration
+	ReusedConnection bool
+}
+
+// BrowserTiming holds the page load milestones reported by a browser's
+// Navigation Timing API, measured from the start of navigation
+type BrowserTiming struct {
+	DOMContentLoaded time.Duration
+	Load             time.Duration
+	RedirectCount    int
+	Redirect         time.Duration
+}
+
+// RequestInfo holds information about the request sent for one hop
+type RequestInfo struct {
+	Method      string
+	HeaderBytes int         // Uncompressed size of the header fields written
+	BodySize    int64       // Request body size, -1 if unknown
+	Header      http.Header // Header fields as written, including Host
+}
+
+// RedirectInfo holds information about a redirect
+type RedirectInfo struct {
+	URL            string
+	HTTPProtocol   string
+	StatusCode     int
+	Status         string
+	ResponseHeader http.Header
+	StartTime      time.Time
+	EndTime        time.Time
+	Timing         Timing
+	Request        RequestInfo
+	DNS            *DNSInfo      // Nil when no lookup was made
+	DialOverride   *DialOverride // Nil when no -connect-to or -resolve rule applied
+	LocalAddr      string        // Local address and port of the connection
+	RemoteAddr     string        // Server address and port the connection was made to
+	Family         string        // IP family of the connection, FamilyIPv4 or FamilyIPv6
+	FamilyFallback bool          // Connected over another family than first attempted
+	Connects       []ConnectAttempt
+	TLS            *TLSInfo // Nil for plain HTTP
+	TraceEvents    []TraceEvent
+}
+
+// Context keys for storing values in request context
+type startTimeContextKey struct{}
+type timingContextKey struct{}
+type requestInfoContextKey struct{}
@@ -1,9 +1,9 @@
-package main
+package probe
 
 import "strings"
 
-// normalizeURL ensures the URL has a proper scheme prefix
-func normalizeURL(url string) string {
+// NormalizeURL ensures the URL has a proper scheme prefix
+func NormalizeURL(url string) string {
 	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
 		return "http://" + url
 	}